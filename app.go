@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v33/github"
+)
+
+// appTransport authenticates requests as a GitHub App installation. Installation tokens are
+// created using a JSON Web Token signed by the app's private key, and renewed before expiring
+type appTransport struct {
+	base           http.RoundTripper
+	appID          int64
+	installationID int64
+	key            *rsa.PrivateKey
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// create a transport authenticating as the app installation, loading the app private key
+// from the PEM file
+func newAppTransport(base http.RoundTripper, appID, installationID int64, keyFile string) (*appTransport, error) {
+	if appID == 0 || installationID == 0 || keyFile == "" {
+		return nil, errors.New("GitHub App authentication requires -app-id, -app-installation-id and -app-key")
+	}
+	key, err := loadAppKey(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	return &appTransport{base: base, appID: appID, installationID: installationID, key: key}, nil
+}
+
+// load an RSA private key from a PEM file, in PKCS#1 (as GitHub generates them) or PKCS#8 form
+func loadAppKey(fn string) (*rsa.PrivateKey, error) {
+	data, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read GitHub App private key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM encoded private key found in %s", fn)
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid GitHub App private key in %s: %w", fn, err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("GitHub App private key in %s is not an RSA key", fn)
+	}
+	return key, nil
+}
+
+func (t *appTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := t.installationToken(req.Context())
+	if err != nil {
+		return nil, err
+	}
+	req = req.Clone(req.Context()) // RoundTrippers should not modify the request
+	req.Header.Set("Authorization", "token "+token)
+	return t.base.RoundTrip(req)
+}
+
+// returns a valid installation token, creating a new one if none was created or it is
+// about to expire
+func (t *appTransport) installationToken(ctx context.Context) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.token != "" && time.Until(t.expires) > time.Minute {
+		return t.token, nil
+	}
+
+	jwt, err := t.jwt(time.Now())
+	if err != nil {
+		return "", err
+	}
+	client := github.NewClient(&http.Client{Transport: &bearerTransport{token: jwt, base: t.base}})
+	it, _, err := client.Apps.CreateInstallationToken(ctx, t.installationID, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create GitHub App installation token: %w", err)
+	}
+	t.token, t.expires = it.GetToken(), it.GetExpiresAt()
+	verbose("created GitHub App installation token, expires at", t.expires.Format(time.RFC3339))
+	return t.token, nil
+}
+
+// returns a JSON Web Token, signed with RS256, authenticating as the app. Issue time is
+// backdated to allow for clock drift, and tokens may be valid for at most 10 minutes
+func (t *appTransport) jwt(now time.Time) (string, error) {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	claims, _ := json.Marshal(map[string]int64{
+		"iat": now.Add(-time.Minute).Unix(),
+		"exp": now.Add(9 * time.Minute).Unix(),
+		"iss": t.appID,
+	})
+	enc := base64.RawURLEncoding
+	unsigned := enc.EncodeToString(header) + "." + enc.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, t.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign GitHub App token: %w", err)
+	}
+	return unsigned + "." + enc.EncodeToString(signature), nil
+}
+
+// bearerTransport sets a bearer authorization header on each request
+type bearerTransport struct {
+	token string
+	base  http.RoundTripper
+}
+
+func (t *bearerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+t.token)
+	return t.base.RoundTrip(req)
+}
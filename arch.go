@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strings"
+
+	"github.com/google/go-github/v33/github"
+)
+
+// asset name substrings hinting at the target architecture, in matching order (e.g.,
+// 'x86_64' must be matched before 'x86')
+var archHints = []struct {
+	substring string
+	arch      string
+}{
+	{"aarch64", "arm64"},
+	{"arm64", "arm64"},
+	{"x86_64", "amd64"},
+	{"x86-64", "amd64"},
+	{"amd64", "amd64"},
+	{"x64", "amd64"},
+	{"i386", "386"},
+	{"i686", "386"},
+	{"x86", "386"},
+	{"armhf", "arm"},
+	{"armv7", "arm"},
+}
+
+// infer the architecture from an asset name, returns an empty string if unknown
+func archFromName(name string) string {
+	name = strings.ToLower(name)
+	for _, h := range archHints {
+		if strings.Contains(name, h.substring) {
+			return h.arch
+		}
+	}
+	return ""
+}
+
+// offsets and magic values used to identify kernel images (see the Linux kernel
+// Documentation/x86/boot.rst and Documentation/arm64/booting.rst)
+const (
+	x86HeaderOffset        = 0x202
+	x86KernelVersionOffset = 0x20e // pointer to the version string, relative to the setup header
+	x86SetupHeaderBase     = 0x200
+	x86XLoadFlagsOffset    = 0x236
+	x86XLFKernel64         = 0x1
+	arm64MagicOffset       = 0x38
+	maxKernelVersionLength = 256
+)
+
+var (
+	x86HeaderMagic = []byte("HdrS")
+	arm64Magic     = []byte("ARM\x64")
+)
+
+// infer the architecture of a kernel image from its headers, returns an empty string if unknown
+func archFromImage(fn string) (string, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	header := make([]byte, x86XLoadFlagsOffset+2)
+	if _, err = io.ReadFull(f, header); err == io.ErrUnexpectedEOF || err == io.EOF {
+		return "", nil // too short to be a kernel image
+	} else if err != nil {
+		return "", err
+	}
+
+	switch {
+	case bytes.Equal(header[arm64MagicOffset:arm64MagicOffset+len(arm64Magic)], arm64Magic):
+		return "arm64", nil
+	case bytes.Equal(header[x86HeaderOffset:x86HeaderOffset+len(x86HeaderMagic)], x86HeaderMagic):
+		if header[x86XLoadFlagsOffset]&x86XLFKernel64 != 0 {
+			return "amd64", nil
+		}
+		return "386", nil
+	}
+	return "", nil
+}
+
+// returns the version string embedded in an x86 bzImage, using the kernel_version pointer
+// in its setup header. Returns an empty string when the image has no such string
+func imageKernelVersion(fn string) (string, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	header := make([]byte, x86KernelVersionOffset+2)
+	if _, err = io.ReadFull(f, header); err == io.ErrUnexpectedEOF || err == io.EOF {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	if !bytes.Equal(header[x86HeaderOffset:x86HeaderOffset+len(x86HeaderMagic)], x86HeaderMagic) {
+		return "", nil
+	}
+	ptr := binary.LittleEndian.Uint16(header[x86KernelVersionOffset:])
+	if ptr == 0 {
+		return "", nil
+	}
+
+	version := make([]byte, maxKernelVersionLength)
+	n, err := f.ReadAt(version, int64(ptr)+x86SetupHeaderBase)
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	version = version[:n]
+	if i := bytes.IndexByte(version, 0); i >= 0 {
+		version = version[:i]
+	}
+	return strings.TrimSpace(string(version)), nil
+}
+
+// check the kernel version embedded in the image matches the version in the release tag
+func checkImageVersion(imageVersion, tag string) error {
+	iv, ok := parseKernelVersion(imageVersion)
+	if !ok {
+		warn("unable to verify the image kernel version, no version found in the image")
+		return nil
+	}
+	tv, ok := parseKernelVersion(tag)
+	if !ok {
+		warn("unable to verify the image kernel version, no version found in release tag", tag)
+		return nil
+	}
+	if iv.compare(tv) != 0 {
+		return fmt.Errorf("image kernel version %s doesn't match release tag %s", iv, tag)
+	}
+	return nil
+}
+
+// returns the host architecture, as set by -arch or otherwise that the tool is built for
+func hostArch() string {
+	if *archFlag != "" && *archFlag != "auto" {
+		return *archFlag
+	}
+	return runtime.GOARCH
+}
+
+// find the release asset of the image built for the architecture, by an architecture hint in
+// the asset label or name. Only assets whose name includes the image name are considered, and
+// nil is returned if none matches
+func findArchAsset(release *github.RepositoryRelease, imageName, arch string) (*github.ReleaseAsset, string) {
+	for _, ra := range release.Assets {
+		if !strings.Contains(ra.GetName(), imageName) {
+			continue
+		}
+		if archFromName(ra.GetLabel()) == arch {
+			return ra, "label '" + ra.GetLabel() + "'"
+		}
+		if archFromName(ra.GetName()) == arch {
+			return ra, "name"
+		}
+	}
+	return nil, ""
+}
+
+// check the architecture matches the host's, unless forced (in which case only a warning is printed)
+func checkArch(arch, source string, force bool) error {
+	if arch == "" || arch == hostArch() {
+		return nil
+	}
+	msg := fmt.Sprintf("%s seems to be built for %s, but host architecture is %s", source, arch, hostArch())
+	if force {
+		warn(msg)
+		return nil
+	}
+	return fmt.Errorf("%s (use -force to override)", msg)
+}
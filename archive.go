@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"time"
+
+	"github.com/google/go-github/v33/github"
+)
+
+// suffix of the file, saved with -archive, describing the release a kernel image came from
+const archiveSuffix = ".release.json"
+
+// release metadata archived alongside a downloaded kernel image
+type releaseArchive struct {
+	Repository string          `json:"repository"`
+	Tag        string          `json:"tag"`
+	Name       string          `json:"name"`
+	Published  time.Time       `json:"published"`
+	Commitish  string          `json:"target_commitish"`
+	URL        string          `json:"url"`
+	Body       string          `json:"body"`
+	Image      string          `json:"image"`
+	Digest     string          `json:"digest"`
+	Assets     []archivedAsset `json:"assets"`
+	Archived   time.Time       `json:"archived"`
+}
+
+// a release asset listed in the archived release metadata
+type archivedAsset struct {
+	Name        string    `json:"name"`
+	ID          int64     `json:"id"`
+	Size        int       `json:"size"`
+	ContentType string    `json:"content_type"`
+	Updated     time.Time `json:"updated"`
+	DownloadURL string    `json:"download_url"`
+}
+
+// returns the archived metadata of the release, with the digest of its downloaded image asset
+func newReleaseArchive(repository string, release *github.RepositoryRelease, image *github.ReleaseAsset, digest string) releaseArchive {
+	a := releaseArchive{
+		Repository: repository,
+		Tag:        release.GetTagName(),
+		Name:       release.GetName(),
+		Published:  release.GetPublishedAt().Time,
+		Commitish:  release.GetTargetCommitish(),
+		URL:        release.GetHTMLURL(),
+		Body:       release.GetBody(),
+		Image:      image.GetName(),
+		Digest:     digest,
+		Assets:     make([]archivedAsset, 0, len(release.Assets)),
+		Archived:   time.Now().UTC(),
+	}
+	for _, asset := range release.Assets {
+		a.Assets = append(a.Assets, archivedAsset{
+			Name:        asset.GetName(),
+			ID:          asset.GetID(),
+			Size:        asset.GetSize(),
+			ContentType: asset.GetContentType(),
+			Updated:     asset.GetUpdatedAt().Time,
+			DownloadURL: asset.GetBrowserDownloadURL(),
+		})
+	}
+	return a
+}
+
+// write the release metadata file next to the image, if -archive is set
+func archiveRelease(fn string, a releaseArchive) error {
+	if !*archive {
+		return nil
+	}
+	b, err := json.MarshalIndent(a, "", "  ")
+	if err != nil {
+		return err
+	}
+	info("archiving release metadata to", fn+archiveSuffix)
+	return ioutil.WriteFile(fn+archiveSuffix, append(b, '\n'), 0644)
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// audit log record of a successful download or install
+type auditEntry struct {
+	Time        time.Time `json:"time"`
+	Repository  string    `json:"repository"`
+	Tag         string    `json:"tag"`
+	Digest      string    `json:"digest"`
+	Destination string    `json:"destination"`
+	Installed   bool      `json:"installed"`
+	Previous    string    `json:"previous_kernel"` // configured kernel before the install
+}
+
+// append the entry, as a single JSON line, to the audit log, if one is set
+func audit(entry auditEntry) error {
+	if *auditLog == "" {
+		return nil
+	}
+	entry.Time = time.Now().UTC()
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(*auditLog, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	_, err = f.Write(append(b, '\n'))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// maximum size of a checksum file, fetched with -checksum-url or -verify-checksum
+const maxChecksumFileSize = 1 << 20
+
+// fetch a plain text checksum file (e.g., sha256sum output) and return the digests listed
+// for the named file
+func fetchChecksum(ctx context.Context, url, name string) ([]string, error) {
+	rc, err := fetchURL(ctx, url, "text/plain, */*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch checksum: %w", err)
+	}
+	defer rc.Close()
+	data, err := readAllLimited(rc, maxChecksumFileSize, "checksum file "+url)
+	if err != nil {
+		return nil, err
+	}
+	return parseChecksum(bytes.NewReader(data), name)
+}
+
+// download a checksum file asset of the release and return the digests listed for the named file
+func releaseChecksum(ctx context.Context, ra *ResolvedAsset, checksumAsset, name string) ([]string, error) {
+	asset, err := findReleaseAsset(ra.Release, checksumAsset)
+	if err != nil {
+		return nil, err
+	}
+	data, err := downloadToMemory(ctx, newResolvedAsset(ra.Repository, ra.Release, asset), maxChecksumFileSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download checksum: %w", err)
+	}
+	return parseChecksum(bytes.NewReader(data), name)
+}
+
+// returns the digests, as <algo>:<hex>, on lines mentioning the named file, the first one of
+// each algorithm (e.g., for manifests listing both SHA256 and SHA512 digests). Input with a
+// single digest needn't name the file
+func parseChecksum(r io.Reader, name string) ([]string, error) {
+	var digests, unnamed []string
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		digest := ""
+		for _, f := range fields {
+			if digest = checksumToken(f); digest != "" {
+				break
+			}
+		}
+		if digest == "" {
+			continue
+		}
+		named := false
+		for _, f := range fields {
+			if strings.TrimPrefix(f, "*") == name || strings.HasSuffix(f, "/"+name) || f == "("+name+")" {
+				named = true
+				break
+			}
+		}
+		if !named {
+			unnamed = append(unnamed, digest)
+			continue
+		}
+		if algo := digestAlgorithm(digest); !seen[algo] {
+			seen[algo] = true
+			digests = append(digests, digest)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read checksum: %w", err)
+	}
+	if len(digests) == 0 && len(unnamed) == 1 {
+		return unnamed, nil
+	}
+	if len(digests) == 0 {
+		return nil, fmt.Errorf("no checksum found for %s", name)
+	}
+	return digests, nil
+}
+
+// verify the file against all the <algo>:<hex> digests, returning the verified algorithms
+func verifyDigests(fn string, digests []string) ([]string, error) {
+	var algorithms []string
+	for _, d := range digests {
+		if err := verifyDigest(fn, d); err != nil {
+			return nil, err
+		}
+		algorithms = append(algorithms, digestAlgorithm(d))
+	}
+	return algorithms, nil
+}
+
+// returns the algorithm of an <algo>:<hex> digest
+func digestAlgorithm(digest string) string {
+	return strings.SplitN(digest, ":", 2)[0]
+}
+
+// returns the token as <algo>:<hex> if it's a hex encoded digest of a supported algorithm
+func checksumToken(token string) string {
+	if _, err := hex.DecodeString(token); err != nil {
+		return ""
+	}
+	switch len(token) {
+	case 40:
+		return sha1Algorithm + ":" + strings.ToLower(token)
+	case 64:
+		return sha256Algorithm + ":" + strings.ToLower(token)
+	case 128:
+		return sha512Algorithm + ":" + strings.ToLower(token)
+	}
+	return ""
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// kinds of [wsl2] section values, as documented for .wslconfig
+const (
+	pathValue = iota
+	sizeValue
+	countValue
+	boolValue
+	textValue
+)
+
+// known [wsl2] section keys and their value kinds
+var wsl2Keys = map[string]int{
+	"kernel":               pathValue,
+	"kernelCommandLine":    textValue,
+	"kernelModules":        pathValue,
+	"memory":               sizeValue,
+	"processors":           countValue,
+	"localhostForwarding":  boolValue,
+	"swap":                 sizeValue,
+	"swapFile":             pathValue,
+	"pageReporting":        boolValue,
+	"guiApplications":      boolValue,
+	"debugConsole":         boolValue,
+	"nestedVirtualization": boolValue,
+	"vmIdleTimeout":        countValue,
+	"dnsProxy":             boolValue,
+	"networkingMode":       textValue,
+	"firewall":             boolValue,
+	"dnsTunneling":         boolValue,
+	"autoProxy":            boolValue,
+	"safeMode":             boolValue,
+	"defaultVhdSize":       sizeValue,
+}
+
+// a size such as 8GB, 512MB or 0 (e.g., to disable swap)
+var sizePattern = regexp.MustCompile(`(?i)^[0-9]+(\.[0-9]+)?\s*(B|[KMGT]B?)?$`)
+
+// a problem found in the configuration. Critical problems prevent WSL from using the value
+type configIssue struct {
+	critical bool
+	message  string
+}
+
+// check the [wsl2] section of .wslconfig for common mistakes, printing each one found.
+// Returns an error if any is critical
+func validateConfig() error {
+	cfg, err := wslConfigLoad()
+	if err != nil {
+		return fmt.Errorf("failed to load %s: %w", wslConfigFile, err)
+	}
+	filename, _ := wslConfigFilePath()
+
+	var issues []configIssue
+	if _, err = cfg.GetSection(wsl2Section); err != nil {
+		issues = append(issues, configIssue{message: fmt.Sprintf("no [%s] section, WSL2 uses its defaults", wsl2Section)})
+	}
+	for _, key := range cfg.Section(wsl2Section).Keys() {
+		if issue, ok := checkConfigKey(key.Name(), strings.TrimSpace(key.String())); ok {
+			issues = append(issues, issue)
+		}
+	}
+
+	critical := 0
+	for _, issue := range issues {
+		if issue.critical {
+			critical++
+			notice("error:", issue.message)
+		} else {
+			warn(issue.message)
+		}
+	}
+	if critical > 0 {
+		return fmt.Errorf("%s has %d errors and %d warnings", filename, critical, len(issues)-critical)
+	}
+	notice(filename, "has no errors and", len(issues), "warnings")
+	return nil
+}
+
+// check a [wsl2] section key and its value, returning the issue found, if any
+func checkConfigKey(name, value string) (configIssue, bool) {
+	kind, known := wsl2Keys[name]
+	if !known {
+		suggestion, best := "", 3 // only suggest keys within two edits
+		for k := range wsl2Keys {
+			d := editDistance(strings.ToLower(k), strings.ToLower(name))
+			if d < best || (d == best && k < suggestion) {
+				suggestion, best = k, d
+			}
+		}
+		if suggestion != "" {
+			return configIssue{message: fmt.Sprintf("unknown key %s, did you mean %s?", name, suggestion)}, true
+		}
+		return configIssue{message: "unknown key " + name}, true
+	}
+
+	switch kind {
+	case pathValue:
+		if name != wsl2KernelKey || value == "" {
+			break
+		}
+		kernel := value
+		if *windowsHome != "" {
+			kernel = mountedPath(kernel)
+		}
+		if _, err := os.Stat(kernel); err != nil {
+			return configIssue{critical: true, message: fmt.Sprintf("kernel %s can't be used: %v", value, err)}, true
+		}
+	case sizeValue:
+		if !sizePattern.MatchString(value) {
+			return configIssue{critical: true, message: fmt.Sprintf("invalid %s size %q, should be like 8GB or 512MB", name, value)}, true
+		}
+	case countValue:
+		if n, err := strconv.Atoi(value); err != nil || n < 0 || (name == "processors" && n == 0) {
+			return configIssue{critical: true, message: fmt.Sprintf("invalid %s value %q, should be a whole number", name, value)}, true
+		}
+	case boolValue:
+		if v := strings.ToLower(value); v != "true" && v != "false" {
+			return configIssue{message: fmt.Sprintf("invalid %s value %q, should be true or false", name, value)}, true
+		}
+	}
+	return configIssue{}, false
+}
+
+// returns the Levenshtein distance between the strings, to suggest corrections for typos
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ask the user to confirm, returning true for a yes answer. Always true with -yes
+func confirm(question string) (bool, error) {
+	if *assumeYes {
+		return true, nil
+	}
+	fmt.Fprintf(infoOut, "%s [y/N] ", question)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && answer == "" {
+		return false, fmt.Errorf("no confirmation (use -yes to skip it): %w", err)
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true, nil
+	}
+	return false, nil
+}
+
+// returns true if confirmations can be prompted for: stdin is a terminal and -yes isn't set
+func interactive() bool {
+	if *assumeYes {
+		return false
+	}
+	fi, err := os.Stdin.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
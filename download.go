@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	"github.com/google/go-github/v33/github"
+)
+
+// result of downloading a single release asset to a temporary file
+type assetDownload struct {
+	asset *github.ReleaseAsset
+	path  string // temporary file holding the downloaded contents
+	bytes int64
+	err   error
+}
+
+// download release assets concurrently, using at most parallel workers. Results are
+// returned in the same order as the assets, and the first failure cancels the remaining
+// downloads. On error, the caller is responsible for removing any temporary file returned.
+func downloadAssets(ctx context.Context, repository string, assets []*github.ReleaseAsset, parallel int) ([]assetDownload, error) {
+	if parallel < 1 {
+		parallel = 1
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make([]assetDownload, len(assets))
+	sem := make(chan struct{}, parallel)
+	var wg sync.WaitGroup
+
+	for i, asset := range assets {
+		wg.Add(1)
+		go func(i int, asset *github.ReleaseAsset) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			results[i] = downloadAssetToTemp(ctx, repository, asset)
+			if results[i].err != nil {
+				cancel()
+			}
+		}(i, asset)
+	}
+	wg.Wait()
+
+	var failed, total int64
+	var err error
+	for _, r := range results {
+		total += r.bytes
+		if r.err != nil {
+			failed++
+			if err == nil {
+				err = fmt.Errorf("failed to download asset %s: %w", r.asset.GetName(), r.err)
+			}
+		}
+	}
+	infof("downloaded %d/%d assets (%d bytes)\n", int64(len(assets))-failed, len(assets), total)
+	if failed > 1 {
+		err = fmt.Errorf("%w (and %d more failures)", err, failed-1)
+	}
+	return results, err
+}
+
+// download a single release asset to a new temporary file
+func downloadAssetToTemp(ctx context.Context, repository string, asset *github.ReleaseAsset) assetDownload {
+	result := assetDownload{asset: asset}
+	if err := ctx.Err(); err != nil {
+		result.err = err
+		return result
+	}
+
+	rc, err := downloadReleaseAsset(ctx, repository, asset)
+	if err != nil {
+		result.err = err
+		return result
+	}
+	defer rc.Close()
+
+	out, err := ioutil.TempFile("", asset.GetName()+".*")
+	if err != nil {
+		result.err = err
+		return result
+	}
+	result.path = out.Name()
+	var r io.Reader = rc
+	if byteRate > 0 {
+		r = newThrottledReader(ctx, r, byteRate)
+	}
+	result.bytes, err = io.Copy(out, r)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(result.path)
+		result.path = ""
+		result.err = err
+	}
+	return result
+}
+
+// maximal size of an image downloaded into memory with -to-memory
+const maxMemoryDownload = 256 << 20
+
+// read all of the reader into memory, failing if it holds more than max bytes
+func readAllLimited(r io.Reader, max int64, name string) ([]byte, error) {
+	data, err := ioutil.ReadAll(io.LimitReader(r, max+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > max {
+		return nil, fmt.Errorf("%s is larger than the %d bytes allowed in memory", name, max)
+	}
+	return data, nil
+}
+
+// download a (small) release asset into memory, failing if larger than max bytes
+func downloadToMemory(ctx context.Context, ra *ResolvedAsset, max int64) ([]byte, error) {
+	if int64(ra.Size) > max {
+		return nil, fmt.Errorf("asset %s is %d bytes, larger than the %d bytes allowed in memory", ra.Name, ra.Size, max)
+	}
+	rc, err := ra.Open(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	var r io.Reader = rc
+	if byteRate > 0 {
+		r = newThrottledReader(ctx, r, byteRate)
+	}
+	return readAllLimited(r, max, "asset "+ra.Name)
+}
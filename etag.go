@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+)
+
+// cached API response, validated by its ETag
+type etagEntry struct {
+	ETag        string `json:"etag"`
+	ContentType string `json:"content_type"`
+	Body        []byte `json:"body"`
+}
+
+// etagTransport caches API responses in a file, sending conditional requests using
+// their ETags. An unchanged response (304) is served from the cache and does not
+// count against the GitHub rate limit.
+type etagTransport struct {
+	base http.RoundTripper
+	file string
+
+	mu      sync.Mutex
+	entries map[string]etagEntry
+}
+
+// create a caching transport, loading previously cached entries from the file, if exists
+func newETagTransport(base http.RoundTripper, file string) (*etagTransport, error) {
+	t := &etagTransport{
+		base:    base,
+		file:    file,
+		entries: make(map[string]etagEntry),
+	}
+	b, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return t, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(b, &t.entries); err != nil {
+		verbose("ignoring invalid ETag cache", file+":", err)
+	}
+	return t, nil
+}
+
+func (t *etagTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet || req.Header.Get("Accept") == "application/octet-stream" {
+		return t.base.RoundTrip(req)
+	}
+
+	// responses differ for authenticated requests (e.g., draft releases are included)
+	key := req.URL.String()
+	if req.Header.Get("Authorization") != "" {
+		key = "auth:" + key
+	}
+
+	t.mu.Lock()
+	entry, cached := t.entries[key]
+	t.mu.Unlock()
+	if cached {
+		req = req.Clone(req.Context())
+		req.Header.Set("If-None-Match", entry.ETag)
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case cached && resp.StatusCode == http.StatusNotModified:
+		verbose("ETag cache hit for", req.URL.String())
+		resp.Body.Close()
+		resp.StatusCode, resp.Status = http.StatusOK, "200 OK"
+		resp.Header.Set("Content-Type", entry.ContentType)
+		resp.Body = ioutil.NopCloser(bytes.NewReader(entry.Body))
+		resp.ContentLength = int64(len(entry.Body))
+	case resp.StatusCode == http.StatusOK && resp.Header.Get("ETag") != "":
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+		t.store(key, etagEntry{
+			ETag:        resp.Header.Get("ETag"),
+			ContentType: resp.Header.Get("Content-Type"),
+			Body:        body,
+		})
+	}
+	return resp, nil
+}
+
+// store the entry and save the cache file
+func (t *etagTransport) store(key string, entry etagEntry) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.entries[key] = entry
+	b, err := json.Marshal(t.entries)
+	if err == nil {
+		err = ioutil.WriteFile(t.file, b, 0600)
+	}
+	if err != nil {
+		verbose("unable to save ETag cache", t.file+":", err)
+	}
+}
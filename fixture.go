@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-github/v33/github"
+)
+
+// fixture of release data, standing in for the GitHub API (e.g., when offline). Releases
+// are in GitHub API format, newest first, and each asset refers to a local file holding
+// its contents
+type fixture struct {
+	Repository string           `json:"repository,omitempty"` // optional, any repository if unset
+	Releases   []fixtureRelease `json:"releases"`
+}
+
+type fixtureRelease struct {
+	github.RepositoryRelease
+	Assets []fixtureAsset `json:"assets"`
+}
+
+type fixtureAsset struct {
+	github.ReleaseAsset
+	Path   string `json:"path"`
+	Digest string `json:"digest,omitempty"`
+}
+
+// fixtureTransport serves the release API requests made by the tool from a fixture
+type fixtureTransport struct {
+	fixture fixture
+}
+
+// load the fixture from the named file, filling in missing asset IDs and sizes
+func newFixtureTransport(fn string) (*fixtureTransport, error) {
+	b, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fixture: %w", err)
+	}
+	t := &fixtureTransport{}
+	if err = json.Unmarshal(b, &t.fixture); err != nil {
+		return nil, fmt.Errorf("invalid fixture %s: %w", fn, err)
+	}
+
+	id := int64(1)
+	for i := range t.fixture.Releases {
+		r := &t.fixture.Releases[i]
+		if r.ID == nil {
+			r.ID = github.Int64(int64(i + 1))
+		}
+		for j := range r.Assets {
+			a := &r.Assets[j]
+			if a.ID == nil {
+				a.ID = github.Int64(id)
+			}
+			id++
+			if a.Size == nil {
+				fi, err := os.Stat(a.Path)
+				if err != nil {
+					return nil, fmt.Errorf("invalid fixture asset %s: %w", a.GetName(), err)
+				}
+				a.Size = github.Int(int(fi.Size()))
+			}
+		}
+	}
+	return t, nil
+}
+
+func (t *fixtureTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// paths are /repos/<owner>/<repo>/releases[/...]
+	parts := strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+	if req.Method != http.MethodGet || len(parts) < 4 || parts[0] != "repos" || parts[3] != "releases" ||
+		(t.fixture.Repository != "" && parts[1]+"/"+parts[2] != t.fixture.Repository) {
+		return fixtureResponse(req, http.StatusNotFound, nil)
+	}
+	releases := t.fixture.Releases
+
+	switch rest := parts[4:]; {
+	case len(rest) == 0:
+		return fixtureResponse(req, http.StatusOK, releases)
+	case len(rest) == 1 && rest[0] == "latest":
+		for _, r := range releases {
+			if !r.GetDraft() && !r.GetPrerelease() {
+				return fixtureResponse(req, http.StatusOK, r)
+			}
+		}
+	case len(rest) == 2 && rest[0] == "tags":
+		for _, r := range releases {
+			if r.GetTagName() == rest[1] {
+				return fixtureResponse(req, http.StatusOK, r)
+			}
+		}
+	case len(rest) == 2 && rest[0] == "assets":
+		id, _ := strconv.ParseInt(rest[1], 10, 64)
+		for _, r := range releases {
+			for _, a := range r.Assets {
+				if a.GetID() != id {
+					continue
+				}
+				if req.Header.Get("Accept") != "application/octet-stream" {
+					return fixtureResponse(req, http.StatusOK, a)
+				}
+				f, err := os.Open(a.Path)
+				if err != nil {
+					return nil, fmt.Errorf("failed to open fixture asset %s: %w", a.GetName(), err)
+				}
+				return &http.Response{
+					StatusCode:    http.StatusOK,
+					Status:        "200 OK",
+					Header:        http.Header{"Content-Type": {"application/octet-stream"}},
+					Body:          f,
+					ContentLength: int64(a.GetSize()),
+					Request:       req,
+				}, nil
+			}
+		}
+	}
+	return fixtureResponse(req, http.StatusNotFound, nil)
+}
+
+// returns a JSON response with the value, or GitHub's error message for failures
+func fixtureResponse(req *http.Request, status int, v interface{}) (*http.Response, error) {
+	if status != http.StatusOK {
+		v = map[string]string{"message": http.StatusText(status)}
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Response{
+		StatusCode:    status,
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		Header:        http.Header{"Content-Type": {"application/json"}},
+		Body:          ioutil.NopCloser(bytes.NewReader(b)),
+		ContentLength: int64(len(b)),
+		Request:       req,
+	}, nil
+}
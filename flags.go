@@ -0,0 +1,57 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// prefix of environment variables setting flag values
+const flagsEnvPrefix = "UPDATE_WSL2_"
+
+// set flags not explicitly set on the command line from their environment variables, if
+// defined. The variable name is the prefix followed by the upper cased flag name, with
+// dashes replaced by underscores (e.g., UPDATE_WSL2_GITHUB_REPO for -github-repo)
+func setFlagsFromEnv(fs *flag.FlagSet, prefix string) error {
+	explicit := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if err != nil || explicit[f.Name] {
+			return
+		}
+		name := prefix + strings.ToUpper(strings.ReplaceAll(f.Name, "-", "_"))
+		if value, ok := os.LookupEnv(name); ok {
+			if serr := fs.Set(f.Name, value); serr != nil {
+				err = fmt.Errorf("invalid value %q for %s: %w", value, name, serr)
+			}
+		}
+	})
+	return err
+}
+
+// stringList is a flag.Value collecting the values of a repeatable string flag
+type stringList []string
+
+func (sl *stringList) String() string {
+	return strings.Join(*sl, ",")
+}
+
+func (sl *stringList) Set(value string) error {
+	*sl = append(*sl, value)
+	return nil
+}
+
+// returns true if the value is in the list
+func (sl stringList) contains(value string) bool {
+	for _, s := range sl {
+		if s == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/google/go-github/v33/github"
+)
+
+// fields available to -format templates, for both listed releases and download summaries
+type formatData struct {
+	Tag         string
+	Name        string // release name
+	Asset       string
+	SHA         string
+	Size        int
+	Downloads   int       // image asset download count
+	Published   time.Time // printed with -date-format using {{date .Published}}
+	Destination string
+	Updated     bool
+}
+
+// parse a -format template, returns nil if empty. Output lines are newline terminated
+func parseFormat(format string) (*template.Template, error) {
+	if format == "" {
+		return nil, nil
+	}
+	if !strings.HasSuffix(format, "\n") {
+		format += "\n"
+	}
+	return template.New("format").Funcs(template.FuncMap{"date": formatDate}).Parse(format)
+}
+
+// format a date using -date-format: a Go time layout, or 'rfc3339' or 'relative' (e.g., '3 days ago')
+func formatDate(t time.Time) string {
+	switch strings.ToLower(*dateFormat) {
+	case "":
+		return t.Format("2006-01-02")
+	case "rfc3339":
+		return t.Format(time.RFC3339)
+	case "relative":
+		return relativeTime(t, time.Now())
+	}
+	return t.Format(*dateFormat)
+}
+
+// returns the time relative to now in the largest whole unit, e.g., '3 days ago' or 'in 2 hours'
+func relativeTime(t, now time.Time) string {
+	d := now.Sub(t)
+	suffix := " ago"
+	if d < 0 {
+		d, suffix = -d, ""
+	}
+	units := []struct {
+		name string
+		d    time.Duration
+	}{
+		{"year", 365 * 24 * time.Hour},
+		{"month", 30 * 24 * time.Hour},
+		{"day", 24 * time.Hour},
+		{"hour", time.Hour},
+		{"minute", time.Minute},
+	}
+	for _, u := range units {
+		if n := int(d / u.d); n > 0 {
+			s := fmt.Sprintf("%d %s", n, u.name)
+			if n > 1 {
+				s += "s"
+			}
+			if suffix == "" {
+				return "in " + s
+			}
+			return s + suffix
+		}
+	}
+	return "just now"
+}
+
+// returns the template fields for a release and its (optional) image asset
+func releaseFormatData(release *github.RepositoryRelease, asset *github.ReleaseAsset) formatData {
+	fd := formatData{
+		Tag:  release.GetTagName(),
+		Name: release.GetName(),
+	}
+	if release.PublishedAt != nil {
+		fd.Published = release.PublishedAt.Time
+	}
+	if asset != nil {
+		fd.Asset, fd.Size, fd.Downloads = asset.GetName(), asset.GetSize(), asset.GetDownloadCount()
+	}
+	return fd
+}
+
+// print the template fields using the template
+func printFormat(tmpl *template.Template, fd formatData) error {
+	return tmpl.Execute(os.Stdout, fd)
+}
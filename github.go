@@ -5,8 +5,14 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net/http"
+	"os"
+	"sort"
+	"strconv"
 	"strings"
+	"text/template"
+	"time"
 
 	"github.com/google/go-github/v33/github"
 )
@@ -15,65 +21,580 @@ import (
 // owner and repository name on creation), but a global variable would do fine here...
 var gh = github.NewClient(nil)
 
+// environment variable holding a GitHub token, used when not set by flags
+const githubTokenEnv = "GITHUB_TOKEN"
+
+// configure the GitHub client to use the transport, authenticating requests using the
+// token, if not empty. A non-zero timeout limits the duration of each request
+func ghConfigure(transport http.RoundTripper, token string, timeout time.Duration) {
+	if token != "" {
+		transport = &tokenTransport{token: token, base: transport}
+	}
+	gh = github.NewClient(&http.Client{Transport: transport, Timeout: timeout})
+}
+
+// returns the GitHub token to use. Precedence is the token value, then the
+// contents of the token file and lastly the GITHUB_TOKEN environment variable
+func ghToken(token, tokenFile string) (string, error) {
+	if token != "" {
+		return token, nil
+	}
+	if tokenFile != "" {
+		b, err := ioutil.ReadFile(tokenFile)
+		if err != nil {
+			return "", fmt.Errorf("failed to read token file: %w", err)
+		}
+		return strings.TrimSpace(string(b)), nil
+	}
+	return os.Getenv(githubTokenEnv), nil
+}
+
+// tokenTransport sets the authorization header on each request
+type tokenTransport struct {
+	token string
+	base  http.RoundTripper
+}
+
+func (t *tokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context()) // RoundTrippers should not modify the request
+	req.Header.Set("Authorization", "token "+t.token)
+	return t.base.RoundTrip(req)
+}
+
+// print the authenticated user, app installation or that requests are anonymous, and the
+// remaining core API rate limit, confirming the credentials are valid before running any
+// real operations
+func whoami(ctx context.Context, authenticated bool, installation int64) error {
+	if authenticated && installation == 0 {
+		user, resp, err := gh.Users.Get(ctx, "")
+		if err != nil {
+			return fmt.Errorf("token rejected: %w", err)
+		}
+		fmt.Println("authenticated as", user.GetLogin())
+		printRate(resp.Rate)
+		return nil
+	}
+
+	// app installations can't query the authenticated user, but rate limits reflect them
+	limits, _, err := gh.RateLimits(ctx)
+	if err != nil {
+		return fmt.Errorf("RateLimits returned error: %w", err)
+	}
+	if installation != 0 {
+		fmt.Println("authenticated as GitHub App installation", installation)
+	} else {
+		fmt.Println("anonymous, no token set")
+	}
+	if limits.Core != nil {
+		printRate(*limits.Core)
+	}
+	return nil
+}
+
+// print the core and search API rate limits of the anonymous or authenticated client, with
+// their remaining requests and reset times. Querying the limits doesn't count against them
+func printRateLimits(ctx context.Context, authenticated bool) error {
+	limits, _, err := gh.RateLimits(ctx)
+	if err != nil {
+		return fmt.Errorf("RateLimits returned error: %w", err)
+	}
+	if authenticated {
+		fmt.Println("authenticated API rate limits:")
+	} else {
+		fmt.Println("anonymous API rate limits (set a token for higher limits):")
+	}
+	for _, l := range []struct {
+		name string
+		rate *github.Rate
+	}{{"core", limits.Core}, {"search", limits.Search}} {
+		if l.rate == nil {
+			continue
+		}
+		reset := l.rate.Reset.Time
+		fmt.Printf("  %-7s %d of %d requests remaining, resets at %s (%s)\n", l.name+":",
+			l.rate.Remaining, l.rate.Limit, reset.Local().Format(time.RFC3339), relativeTime(reset, time.Now()))
+	}
+	return nil
+}
+
+// print the remaining requests of the rate limit and its reset time
+func printRate(rate github.Rate) {
+	fmt.Printf("rate limit: %d of %d requests remaining, resets at %s\n",
+		rate.Remaining, rate.Limit, rate.Reset.Local().Format(time.RFC3339))
+}
+
+// options controlling how releases are listed
+type listOptions struct {
+	latestPerMajor bool               // list only the newest release of each major.minor kernel line
+	format         *template.Template // per release output format, if not nil
+	imageName      string             // image asset name, providing the size for formatted output
+	sinceTag       string             // list only releases newer than the release with this tag
+	showDownloads  bool               // list release assets with their download counts
+	showSize       bool               // list the size of each release's image asset
+}
+
 // list recent releases in repository, printing out release tag, publish date and status
-func listReleases(ctx context.Context, repository string) error {
+func listReleases(ctx context.Context, repository string, opts listOptions) error {
 	owner, repo, err := ghOwnerAndRepo(repository)
 	if err != nil {
 		return err
 	}
 
-	releases, _, err := gh.Repositories.ListReleases(ctx, owner, repo, nil)
-	if err != nil {
+	var releases []*github.RepositoryRelease
+	if opts.sinceTag != "" {
+		if releases, err = listReleasesSince(ctx, owner, repo, opts.sinceTag); err != nil {
+			return err
+		}
+	} else if releases, _, err = gh.Repositories.ListReleases(ctx, owner, repo, nil); err != nil {
 		return fmt.Errorf("Repositories.ListReleases returned error: %w", err)
 	}
 
 	fmt.Println("listing recent releases from", repository)
-	for _, release := range releases {
-		fmt.Printf("release %s published %v (draft/pre-release: %t)\n",
-			*release.TagName, release.PublishedAt.Format("2006-01-02"),
-			*release.Draft || *release.Prerelease)
+	var unparsed []*github.RepositoryRelease
+	if opts.latestPerMajor {
+		releases, unparsed = latestPerMajor(releases)
+	}
+	if err = printReleases(releases, opts); err != nil {
+		return err
+	}
+	if len(unparsed) > 0 {
+		fmt.Println("releases with tags not parsed as kernel versions:")
+		return printReleases(unparsed, opts)
 	}
 	return nil
 }
 
-// get release asset by name from specified release tag
-// Caller is responsible forclosing the returned io.ReadCloser
-func getReleaseAsset(ctx context.Context, repository, tag, filename string) (io.ReadCloser, string, error) {
+// print the tags of the releases, newest first, one per line. At most limit tags are
+// printed, paging through releases as needed, or all of them if limit is 0
+func listTags(ctx context.Context, repository string, limit int) error {
 	owner, repo, err := ghOwnerAndRepo(repository)
 	if err != nil {
-		return nil, "", err
+		return err
 	}
 
-	ghRelease := &github.RepositoryRelease{}
-	ghReleaseTag := tag
+	opts := &github.ListOptions{PerPage: 100}
+	if limit > 0 && limit < opts.PerPage {
+		opts.PerPage = limit
+	}
+	printed := 0
+	for {
+		releases, resp, err := gh.Repositories.ListReleases(ctx, owner, repo, opts)
+		if err != nil {
+			return fmt.Errorf("Repositories.ListReleases returned error: %w", err)
+		}
+		for _, release := range releases {
+			if limit > 0 && printed == limit {
+				return nil
+			}
+			fmt.Println(release.GetTagName())
+			printed++
+		}
+		if resp.NextPage == 0 {
+			return nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
 
-	if tag == "" || tag == "latest" {
-		tag = "latest"
-		ghRelease, _, err = gh.Repositories.GetLatestRelease(ctx, owner, repo)
-	} else {
-		ghRelease, _, err = gh.Repositories.GetReleaseByTag(ctx, owner, repo, tag)
+// list the releases newer than the release with the tag, scanning as many pages as needed to
+// find it. Releases are compared by publish date or, when missing, by their tag versions
+func listReleasesSince(ctx context.Context, owner, repo, tag string) ([]*github.RepositoryRelease, error) {
+	var scanned []*github.RepositoryRelease
+	since, err := scanReleases(ctx, owner, repo, func(r *github.RepositoryRelease) bool {
+		if r.GetTagName() == tag {
+			return true
+		}
+		scanned = append(scanned, r)
+		return false
+	})
+	if err != nil {
+		return nil, fmt.Errorf("release tagged %s not found in %s/%s: %w", tag, owner, repo, err)
+	}
+
+	sinceVersion, sinceParsed := parseKernelVersion(since.GetTagName())
+	var newer []*github.RepositoryRelease
+	for _, r := range scanned {
+		if r.PublishedAt != nil && since.PublishedAt != nil {
+			if r.PublishedAt.After(since.PublishedAt.Time) {
+				newer = append(newer, r)
+			}
+		} else if v, ok := parseKernelVersion(r.GetTagName()); ok && sinceParsed && v.compare(sinceVersion) > 0 {
+			newer = append(newer, r)
+		}
+	}
+	return newer, nil
+}
+
+// print releases, one per line, using the list options format if set
+func printReleases(releases []*github.RepositoryRelease, opts listOptions) error {
+	for _, release := range releases {
+		if opts.format == nil {
+			line := formatRelease(release)
+			if opts.showSize { // assets are listed with their release, so no extra lookup is needed
+				if asset, err := findReleaseAsset(release, opts.imageName); err == nil {
+					line += fmt.Sprintf(", %s %d bytes", asset.GetName(), asset.GetSize())
+				} else {
+					line += fmt.Sprintf(", no %s asset", opts.imageName)
+				}
+			}
+			fmt.Println(line)
+			if opts.showDownloads {
+				for _, ra := range release.Assets {
+					fmt.Printf("  asset %s downloaded %d times\n", ra.GetName(), ra.GetDownloadCount())
+				}
+			}
+			continue
+		}
+		asset, _ := findReleaseAsset(release, opts.imageName)
+		if err := printFormat(opts.format, releaseFormatData(release, asset)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// select the newest release of each major.minor kernel line, ordered by descending version.
+// Releases whose tags can't be parsed as versions are returned separately
+func latestPerMajor(releases []*github.RepositoryRelease) ([]*github.RepositoryRelease, []*github.RepositoryRelease) {
+	newest := make(map[string]*github.RepositoryRelease)
+	versions := make(map[string]kernelVersion)
+	var lines []string
+	var unparsed []*github.RepositoryRelease
+
+	for _, release := range releases {
+		v, ok := parseKernelVersion(release.GetTagName())
+		if !ok {
+			unparsed = append(unparsed, release)
+			continue
+		}
+		current, found := versions[v.line()]
+		if !found {
+			lines = append(lines, v.line())
+		}
+		if !found || v.compare(current) > 0 {
+			newest[v.line()], versions[v.line()] = release, v
+		}
+	}
+
+	sort.Slice(lines, func(i, j int) bool {
+		return versions[lines[i]].compare(versions[lines[j]]) > 0
+	})
+	selected := make([]*github.RepositoryRelease, 0, len(lines))
+	for _, line := range lines {
+		selected = append(selected, newest[line])
+	}
+	return selected, unparsed
+}
+
+// format a release for listing, substituting defaults for fields missing in the API response
+func formatRelease(release *github.RepositoryRelease) string {
+	tag := release.GetTagName()
+	if tag == "" {
+		tag = "unnamed"
+	}
+	published := "(no date)"
+	if release.PublishedAt != nil {
+		published = formatDate(release.PublishedAt.Time)
+	}
+	return fmt.Sprintf("release %s published %v (draft/pre-release: %t)",
+		tag, published, release.GetDraft() || release.GetPrerelease())
+}
+
+// criteria for selecting a release and its image asset
+type releaseQuery struct {
+	tag           string             // release tag, latest release if empty or "latest"
+	includeDrafts bool               // consider draft releases for the latest release
+	before        time.Time          // newest release published before this time, if not zero
+	commit        string             // release targeting this commit (SHA prefix), if not empty
+	nameMatch     string             // newest release whose name contains this substring, if not empty
+	assetTemplate *template.Template // renders the asset name from the release, if not nil
+	arch          string             // prefer the image asset built for this architecture, if not empty
+}
+
+// get release asset by name from the release matching the query. The name is rendered
+// from the query's asset template instead, if set
+func getReleaseAsset(ctx context.Context, repository string, query releaseQuery, filename string) (*github.RepositoryRelease, *github.ReleaseAsset, error) {
+	ghRelease, err := resolveRelease(ctx, repository, query)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if query.assetTemplate != nil {
+		var name strings.Builder
+		if err = query.assetTemplate.Execute(&name, releaseFormatData(ghRelease, nil)); err != nil {
+			return nil, nil, fmt.Errorf("failed to render image name template: %w", err)
+		}
+		filename = name.String()
+	}
+
+	if query.arch != "" {
+		if ra, how := findArchAsset(ghRelease, filename, query.arch); ra != nil {
+			info("selected asset", ra.GetName(), "built for", query.arch, "(matched by its "+how+")")
+			return ghRelease, ra, nil
+		}
+		verbose("no asset found for", query.arch+", falling back to", filename)
+	}
+	ra, err := findReleaseAsset(ghRelease, filename)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w in %s", err, repository)
+	}
+	return ghRelease, ra, nil
+}
+
+// releaseNotFoundError is returned when no release has the requested tag
+type releaseNotFoundError struct {
+	tag        string
+	repository string
+}
+
+func (e *releaseNotFoundError) Error() string {
+	return fmt.Sprintf("release tagged %s not found in %s; try -list", e.tag, e.repository)
+}
+
+// tag selecting the latest release, same as not setting a tag
+const latestTag = "latest"
+
+// returns true if the query selects the release with a specific tag, rather than the latest
+// release (possibly filtered by date, commit or including drafts)
+func (q releaseQuery) specificTag() bool {
+	return q.tag != "" && q.tag != latestTag
+}
+
+// check the query criteria don't conflict
+func (q releaseQuery) validate() error {
+	if q.specificTag() && (!q.before.IsZero() || q.commit != "" || q.nameMatch != "") {
+		return fmt.Errorf("tag %s selects a specific release and can't be combined with -before, -at-commit or -name-match", q.tag)
 	}
+	return nil
+}
 
+// resolve the release matching the query
+func resolveRelease(ctx context.Context, repository string, query releaseQuery) (*github.RepositoryRelease, error) {
+	if err := query.validate(); err != nil {
+		return nil, err
+	}
+	owner, repo, err := ghOwnerAndRepo(repository)
 	if err != nil {
-		return nil, "", err
+		return nil, err
 	}
 
-	id := int64(0)
-	if ghReleaseTag == "" {
-		ghReleaseTag = *ghRelease.TagName
+	var ghRelease *github.RepositoryRelease
+	if query.specificTag() {
+		ghRelease, err = resolveTaggedRelease(ctx, owner, repo, query.tag)
+	} else {
+		ghRelease, err = resolveLatestRelease(ctx, owner, repo, query)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if ghRelease.GetDraft() {
+		warn("selected draft release", ghRelease.GetTagName()+", draft assets require authentication")
+	}
+	return ghRelease, nil
+}
+
+// resolve the release with the tag, returning a releaseNotFoundError if there's none
+func resolveTaggedRelease(ctx context.Context, owner, repo, tag string) (*github.RepositoryRelease, error) {
+	ghRelease, _, err := gh.Repositories.GetReleaseByTag(ctx, owner, repo, tag)
+	var ghErr *github.ErrorResponse
+	if errors.As(err, &ghErr) && ghErr.Response != nil && ghErr.Response.StatusCode == http.StatusNotFound {
+		return nil, &releaseNotFoundError{tag: tag, repository: owner + "/" + repo}
+	}
+	return ghRelease, err
+}
+
+// resolve the latest release matching the query's date, commit, name and draft criteria
+func resolveLatestRelease(ctx context.Context, owner, repo string, query releaseQuery) (*github.RepositoryRelease, error) {
+	switch {
+	case !query.before.IsZero() || query.commit != "" || query.nameMatch != "":
+		release, err := scanReleases(ctx, owner, repo, func(r *github.RepositoryRelease) bool {
+			if r.GetPrerelease() || (r.GetDraft() && !query.includeDrafts) {
+				return false
+			}
+			if query.commit != "" && !strings.HasPrefix(r.GetTargetCommitish(), query.commit) {
+				return false
+			}
+			if query.nameMatch != "" && !strings.Contains(r.GetName(), query.nameMatch) {
+				return false
+			}
+			return query.before.IsZero() || (r.PublishedAt != nil && r.PublishedAt.Before(query.before))
+		})
+		if err != nil && query.nameMatch != "" {
+			return nil, fmt.Errorf("no release name contains %q: %w", query.nameMatch, err)
+		}
+		if err == nil && query.nameMatch != "" {
+			info("selected release", strconv.Quote(release.GetName()), "tagged", release.GetTagName())
+		}
+		return release, err
+	case query.includeDrafts:
+		return getLatestReleaseIncludingDrafts(ctx, owner, repo)
+	}
+	ghRelease, _, err := gh.Repositories.GetLatestRelease(ctx, owner, repo)
+	return ghRelease, err
+}
+
+// scan releases, newest first, returning the first one matching
+func scanReleases(ctx context.Context, owner, repo string, match func(*github.RepositoryRelease) bool) (*github.RepositoryRelease, error) {
+	perPage := 100
+	if *scanLimit > 0 && *scanLimit < perPage {
+		perPage = *scanLimit
+	}
+	opts := &github.ListOptions{PerPage: perPage}
+	scanned := 0
+	for {
+		releases, resp, err := gh.Repositories.ListReleases(ctx, owner, repo, opts)
+		if err != nil {
+			return nil, fmt.Errorf("Repositories.ListReleases returned error: %w", err)
+		}
+		for _, release := range releases {
+			if *scanLimit > 0 && scanned == *scanLimit {
+				return nil, fmt.Errorf("no matching release found in the latest %d releases of %s/%s (see -scan-limit)",
+					scanned, owner, repo)
+			}
+			scanned++
+			if match(release) {
+				return release, nil
+			}
+		}
+		if resp.NextPage == 0 {
+			return nil, fmt.Errorf("no matching release found in %s/%s", owner, repo)
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+// get the most recent non pre-release, including drafts (visible only when authenticated)
+func getLatestReleaseIncludingDrafts(ctx context.Context, owner, repo string) (*github.RepositoryRelease, error) {
+	releases, _, err := gh.Repositories.ListReleases(ctx, owner, repo, nil)
+	if err != nil {
+		return nil, fmt.Errorf("Repositories.ListReleases returned error: %w", err)
+	}
+	for _, release := range releases {
+		if !release.GetPrerelease() {
+			return release, nil
+		}
 	}
+	return nil, fmt.Errorf("no releases found in %s/%s", owner, repo)
+}
 
-	for _, ra := range ghRelease.Assets {
-		if *ra.Name == filename {
-			id = *ra.ID
-			break
+// find a release asset by name
+func findReleaseAsset(release *github.RepositoryRelease, filename string) (*github.ReleaseAsset, error) {
+	var found []*github.ReleaseAsset
+	for _, ra := range release.Assets {
+		if ra.GetName() == filename {
+			found = append(found, ra)
 		}
 	}
-	if id == int64(0) {
-		return nil, "", fmt.Errorf("asset %s not found in release %s tagged %s", filename, repository, tag)
+	switch len(found) {
+	case 0:
+		return nil, fmt.Errorf("asset %s not found in release tagged %s", filename, release.GetTagName())
+	case 1:
+		return found[0], nil
+	}
+	// duplicate names, only -asset-id tells which one is wanted
+	ids := make([]string, len(found))
+	for i, ra := range found {
+		if ra.GetID() == *assetID {
+			return ra, nil
+		}
+		ids[i] = strconv.FormatInt(ra.GetID(), 10)
+	}
+	return nil, fmt.Errorf("release tagged %s has %d assets named %s (IDs %s), select one with -asset-id",
+		release.GetTagName(), len(found), filename, strings.Join(ids, ", "))
+}
+
+// get a release asset by its ID
+func getReleaseAssetByID(ctx context.Context, repository string, id int64) (*github.ReleaseAsset, error) {
+	owner, repo, err := ghOwnerAndRepo(repository)
+	if err != nil {
+		return nil, err
+	}
+	asset, _, err := gh.Repositories.GetReleaseAsset(ctx, owner, repo, id)
+	return asset, err
+}
+
+// download the release asset contents. The API redirects asset requests to a storage
+// host, which is then requested explicitly as an octet-stream by the download client
+func downloadReleaseAsset(ctx context.Context, repository string, asset *github.ReleaseAsset) (io.ReadCloser, error) {
+	owner, repo, err := ghOwnerAndRepo(repository)
+	if err != nil {
+		return nil, err
+	}
+	rc, location, err := gh.Repositories.DownloadReleaseAsset(ctx, owner, repo, asset.GetID(), nil)
+	if err == nil && location != "" {
+		rc, err = downloadURL(ctx, location)
+	}
+	if err != nil && asset.GetBrowserDownloadURL() != "" {
+		info("asset download failed, retrying from", asset.GetBrowserDownloadURL()+":", err)
+		return downloadURL(ctx, asset.GetBrowserDownloadURL())
+	}
+	return rc, err
+}
+
+// download binary content from a plain URL, following redirects
+func downloadURL(ctx context.Context, url string) (io.ReadCloser, error) {
+	return fetchURL(ctx, url, "application/octet-stream")
+}
+
+// fetch a plain URL accepting the media type, following redirects
+func fetchURL(ctx context.Context, url, accept string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", accept)
+	req.Header.Set("User-Agent", gh.UserAgent)
+	resp, err := downloadClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected status downloading %s: %s", url, resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// get the digest GitHub publishes for a release asset (e.g., 'sha256:<hex>'). The field is
+// not part of the client's asset type, so it is decoded directly from the API response.
+// Returns an empty string when the API doesn't expose a digest for the asset.
+func getReleaseAssetDigest(ctx context.Context, repository string, asset *github.ReleaseAsset) (string, error) {
+	owner, repo, err := ghOwnerAndRepo(repository)
+	if err != nil {
+		return "", err
+	}
+	u := fmt.Sprintf("repos/%s/%s/releases/assets/%d", owner, repo, asset.GetID())
+	req, err := gh.NewRequest("GET", u, nil)
+	if err != nil {
+		return "", err
+	}
+	ra := struct {
+		Digest string `json:"digest"`
+	}{}
+	if _, err = gh.Do(ctx, req, &ra); err != nil {
+		return "", err
+	}
+	return ra.Digest, nil
+}
+
+// repositories trusted by default, unless overridden by -allowed-repos
+var defaultAllowedRepositories = []string{
+	"nathanchance/WSL2-Linux-Kernel",
+	"microsoft/WSL2-Linux-Kernel",
+}
+
+// check the repository is in the allowed list (compared case insensitively, as GitHub does)
+func ghCheckRepositoryAllowed(repository string, allowed []string) error {
+	if len(allowed) == 0 {
+		allowed = defaultAllowedRepositories
+	}
+	for _, r := range allowed {
+		if strings.EqualFold(strings.TrimSpace(r), repository) {
+			return nil
+		}
 	}
-	rc, _, err := gh.Repositories.DownloadReleaseAsset(ctx, owner, repo, id, http.DefaultClient)
-	return rc, ghReleaseTag, err
+	return fmt.Errorf("repository %s is not in the allowed list (%s), use -allow-any-repo to override",
+		repository, strings.Join(allowed, ", "))
 }
 
 // split the combined repository string into owner and repository name
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v33/github"
+)
+
+func TestResolveRelease(t *testing.T) {
+	dir := tempDir(t)
+	useFixture(t, testRelease(t, dir, "5.10.16", "bzImage"), testRelease(t, dir, "5.4.72", "bzImage"))
+
+	tests := []struct {
+		tag      string
+		want     string
+		notFound bool
+	}{
+		{tag: "", want: "5.10.16"},
+		{tag: latestTag, want: "5.10.16"},
+		{tag: "5.4.72", want: "5.4.72"},
+		{tag: "5.15.0", notFound: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.tag, func(t *testing.T) {
+			release, err := resolveRelease(context.Background(), "owner/repo", releaseQuery{tag: tt.tag})
+			if tt.notFound {
+				var notFound *releaseNotFoundError
+				if !errors.As(err, &notFound) {
+					t.Fatalf("resolveRelease() error = %v, want a releaseNotFoundError", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("resolveRelease() error = %v", err)
+			}
+			if got := release.GetTagName(); got != tt.want {
+				t.Errorf("resolveRelease() tag = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindReleaseAssetDuplicates(t *testing.T) {
+	release := &github.RepositoryRelease{
+		TagName: github.String("5.10.16"),
+		Assets: []*github.ReleaseAsset{
+			{ID: github.Int64(11), Name: github.String("bzImage")},
+			{ID: github.Int64(12), Name: github.String("modules.tar.gz")},
+			{ID: github.Int64(13), Name: github.String("bzImage")},
+		},
+	}
+
+	if _, err := findReleaseAsset(release, "bzImage"); err == nil || !strings.Contains(err.Error(), "IDs 11, 13") {
+		t.Errorf("findReleaseAsset() error = %v, want one listing the duplicate IDs", err)
+	}
+	if asset, err := findReleaseAsset(release, "modules.tar.gz"); err != nil || asset.GetID() != 12 {
+		t.Errorf("findReleaseAsset() = %v, %v, want the unique asset", asset, err)
+	}
+
+	setInt64(t, assetID, 13)
+	if asset, err := findReleaseAsset(release, "bzImage"); err != nil || asset.GetID() != 13 {
+		t.Errorf("findReleaseAsset() with -asset-id = %v, %v, want asset 13", asset, err)
+	}
+	setInt64(t, assetID, 12) // not one of the duplicates
+	if _, err := findReleaseAsset(release, "bzImage"); err == nil {
+		t.Error("findReleaseAsset() with -asset-id of another asset succeeded")
+	}
+}
+
+// roundTripFunc serves requests with a function, as a fake GitHub API
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+func TestResolveTaggedReleaseNotFound(t *testing.T) {
+	tests := []struct {
+		status   int
+		notFound bool
+	}{
+		{http.StatusNotFound, true},
+		{http.StatusInternalServerError, false},
+	}
+	for _, tt := range tests {
+		t.Run(http.StatusText(tt.status), func(t *testing.T) {
+			oldGH := gh
+			ghConfigure(roundTripFunc(func(req *http.Request) (*http.Response, error) {
+				return fixtureResponse(req, tt.status, nil)
+			}), "", 0)
+			t.Cleanup(func() { gh = oldGH })
+
+			_, err := resolveTaggedRelease(context.Background(), "owner", "repo", "5.15.0")
+			var notFound *releaseNotFoundError
+			if errors.As(err, &notFound) != tt.notFound {
+				t.Fatalf("resolveTaggedRelease() error = %v (%T), want releaseNotFoundError %t", err, err, tt.notFound)
+			}
+			want := exitFailure
+			if tt.notFound {
+				want = exitNotFound
+			}
+			if got := exitCode(fmt.Errorf("wrapped: %w", err)); got != want {
+				t.Errorf("exitCode() = %d, want %d", got, want)
+			}
+		})
+	}
+}
+
+func TestFormatRelease(t *testing.T) {
+	published := &github.Timestamp{Time: time.Date(2021, 2, 1, 12, 0, 0, 0, time.UTC)}
+	tests := []struct {
+		name    string
+		release *github.RepositoryRelease
+		want    string
+	}{
+		{"missing fields", &github.RepositoryRelease{}, "release unnamed published (no date) (draft/pre-release: false)"},
+		{"release", &github.RepositoryRelease{TagName: github.String("5.10.16"), PublishedAt: published},
+			"release 5.10.16 published 2021-02-01 (draft/pre-release: false)"},
+		{"pre-release", &github.RepositoryRelease{TagName: github.String("5.15-rc1"), PublishedAt: published, Prerelease: github.Bool(true)},
+			"release 5.15-rc1 published 2021-02-01 (draft/pre-release: true)"},
+		{"draft", &github.RepositoryRelease{Draft: github.Bool(true)}, "release unnamed published (no date) (draft/pre-release: true)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := formatRelease(tt.release); got != tt.want {
+				t.Errorf("formatRelease() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
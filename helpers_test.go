@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v33/github"
+)
+
+// create a temporary directory removed once the test completes
+func tempDir(t *testing.T) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "wsl2-kernel-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+// set the boolean flag for the duration of the test
+func setBool(t *testing.T, p *bool, value bool) {
+	old := *p
+	*p = value
+	t.Cleanup(func() { *p = old })
+}
+
+// set the string flag for the duration of the test
+func setString(t *testing.T, p *string, value string) {
+	old := *p
+	*p = value
+	t.Cleanup(func() { *p = old })
+}
+
+// set the int flag for the duration of the test
+func setInt(t *testing.T, p *int, value int) {
+	old := *p
+	*p = value
+	t.Cleanup(func() { *p = old })
+}
+
+// set the int64 flag for the duration of the test
+func setInt64(t *testing.T, p *int64, value int64) {
+	old := *p
+	*p = value
+	t.Cleanup(func() { *p = old })
+}
+
+// write the files, with their names as contents
+func writeFiles(t *testing.T, dir string, names ...string) {
+	t.Helper()
+	for _, name := range names {
+		if err := ioutil.WriteFile(path.Join(dir, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// returns a fixture release with the tag, its assets holding their name and the tag
+func testRelease(t *testing.T, dir, tag string, assets ...string) fixtureRelease {
+	t.Helper()
+	r := fixtureRelease{RepositoryRelease: github.RepositoryRelease{
+		TagName:     github.String(tag),
+		Name:        github.String("release " + tag),
+		PublishedAt: &github.Timestamp{Time: time.Date(2021, 2, 1, 0, 0, 0, 0, time.UTC)},
+	}}
+	for _, name := range assets {
+		fn := path.Join(dir, tag+"-"+name)
+		if err := ioutil.WriteFile(fn, []byte(name+" "+tag), 0644); err != nil {
+			t.Fatal(err)
+		}
+		r.Assets = append(r.Assets, fixtureAsset{ReleaseAsset: github.ReleaseAsset{Name: github.String(name)}, Path: fn})
+	}
+	return r
+}
+
+// returns a transport serving the GitHub API and asset downloads from a fixture of the
+// releases, newest first
+func newTestFixture(t *testing.T, releases ...fixtureRelease) *fixtureTransport {
+	t.Helper()
+	b, err := json.Marshal(fixture{Releases: releases})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fn := path.Join(tempDir(t), "fixture.json")
+	if err = ioutil.WriteFile(fn, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+	ft, err := newFixtureTransport(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ft
+}
+
+// serve the GitHub API and asset downloads from a fixture of the releases, newest first,
+// for the duration of the test
+func useFixture(t *testing.T, releases ...fixtureRelease) {
+	t.Helper()
+	useTransport(t, newTestFixture(t, releases...))
+}
+
+// send the GitHub API and asset download requests through the transport for the duration
+// of the test
+func useTransport(t *testing.T, rt http.RoundTripper) {
+	oldGH, oldDownload := gh, downloadClient
+	ghConfigure(rt, "", 0)
+	downloadClient = &http.Client{Transport: rt}
+	t.Cleanup(func() { gh, downloadClient = oldGH, oldDownload })
+}
+
+// set, or unset if empty, the environment variable for the duration of the test
+func setEnv(t *testing.T, name, value string) {
+	old, ok := os.LookupEnv(name)
+	if value == "" {
+		os.Unsetenv(name)
+	} else {
+		os.Setenv(name, value)
+	}
+	t.Cleanup(func() {
+		if ok {
+			os.Setenv(name, old)
+		} else {
+			os.Unsetenv(name)
+		}
+	})
+}
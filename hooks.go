@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"unicode"
+)
+
+// run a hook command line, split into arguments by splitCommand, with the additional arguments and
+// environment variables. The hook is killed if it runs longer than -hook-timeout, and its
+// combined output is displayed once it exits
+func runHook(ctx context.Context, name, command string, args []string, env ...string) error {
+	fields, err := splitCommand(command)
+	if err != nil {
+		return fmt.Errorf("invalid %s: %w", name, err)
+	}
+	if *hookTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *hookTimeout)
+		defer cancel()
+	}
+
+	info("running", name+":", strings.Join(append(fields, args...), " "))
+	cmd := exec.CommandContext(ctx, fields[0], append(fields[1:], args...)...)
+	cmd.Env = append(os.Environ(), env...)
+	out, err := cmd.CombinedOutput()
+	for _, line := range strings.Split(strings.TrimRight(string(out), "\n"), "\n") {
+		if line != "" {
+			notice(name+":", line)
+		}
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%s timed out after %s", name, *hookTimeout)
+	}
+	if err != nil {
+		return fmt.Errorf("%s failed: %w", name, err)
+	}
+	return nil
+}
+
+// split a command line into arguments on white space, except within single or double quotes.
+// Backslashes are kept as is, so Windows paths need no escaping
+func splitCommand(command string) ([]string, error) {
+	var args []string
+	var arg strings.Builder
+	inArg := false
+	var quote rune
+	for _, r := range command {
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			arg.WriteRune(r)
+		case r == '"' || r == '\'':
+			quote, inArg = r, true
+		case unicode.IsSpace(r):
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote in %s", quote, command)
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	if len(args) == 0 {
+		return nil, errors.New("empty command")
+	}
+	return args, nil
+}
+
+// postInstallHookError is returned when the post-install hook fails after a successful install
+type postInstallHookError struct {
+	err error
+}
+
+func (e *postInstallHookError) Error() string { return "kernel installed, but " + e.err.Error() }
+func (e *postInstallHookError) Unwrap() error { return e.err }
+
+// run the post-install hook, if set, with the installed kernel path and release tag as
+// arguments, also set as the WSL2_KERNEL and WSL2_KERNEL_TAG environment variables
+func postInstall(ctx context.Context, kernel, tag string) error {
+	if *postHook == "" {
+		return nil
+	}
+	err := runHook(ctx, "post-install hook", *postHook, []string{kernel, tag},
+		"WSL2_KERNEL="+kernel, "WSL2_KERNEL_TAG="+tag)
+	if err != nil {
+		return &postInstallHookError{err: err}
+	}
+	return nil
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HTTP client used for downloading release assets, following redirects
+var downloadClient = http.DefaultClient
+
+// configure the GitHub API and asset download clients based on flags. The -http-timeout
+// limit applies to each request separately, including reading its response body, so it
+// also bounds the time a single download attempt may take
+func configureHTTP(token string) error {
+	if *fixtureFile != "" { // serve everything from the fixture, without any network access
+		ft, err := newFixtureTransport(*fixtureFile)
+		if err != nil {
+			return err
+		}
+		downloadClient = &http.Client{Transport: ft, Timeout: *httpTimeout}
+		ghConfigure(ft, token, *httpTimeout)
+		return nil
+	}
+
+	api, err := newTransport(false)
+	if err != nil {
+		return err
+	}
+	download, err := newTransport(true)
+	if err != nil {
+		return err
+	}
+	downloadClient = &http.Client{Transport: download, Timeout: *httpTimeout}
+
+	var apiTransport http.RoundTripper = api
+	if *etagCache != "" {
+		if apiTransport, err = newETagTransport(api, *etagCache); err != nil {
+			return err
+		}
+	}
+	if *appID != 0 || *appInstall != 0 || *appKey != "" { // GitHub App credentials take precedence
+		if apiTransport, err = newAppTransport(apiTransport, *appID, *appInstall, *appKey); err != nil {
+			return err
+		}
+		token = ""
+	}
+	ghConfigure(apiTransport, token, *httpTimeout)
+	return nil
+}
+
+// create an HTTP transport configured by flags. Some settings only apply to asset downloads
+func newTransport(download bool) (*http.Transport, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	tlsConfig := &tls.Config{}
+	if *pinCert != "" {
+		pins, err := parseFingerprints(*pinCert)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			return verifyPinnedCertificate(rawCerts, pins)
+		}
+	}
+	if *caCert != "" {
+		pool, err := loadCertPool(*caCert)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = pool
+	}
+	transport.TLSClientConfig = tlsConfig
+
+	if *socks5 != "" {
+		proxy, err := parseSOCKS5(*socks5)
+		if err != nil {
+			return nil, err
+		}
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+
+	if download && *localAddr != "" {
+		laddr, err := parseLocalAddr(*localAddr)
+		if err != nil {
+			return nil, err
+		}
+		dialer := &net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+			LocalAddr: laddr,
+		}
+		transport.DialContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+			conn, err := dialer.DialContext(ctx, network, address)
+			if err != nil {
+				return nil, fmt.Errorf("failed to connect from local address %s: %w", laddr, err)
+			}
+			return conn, nil
+		}
+	}
+	return transport, nil
+}
+
+// returns the system certificate pool extended with the certificates in the PEM file
+func loadCertPool(fn string) (*x509.CertPool, error) {
+	data, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA certificates: %w", err)
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+
+	count := 0
+	for {
+		var block *pem.Block
+		if block, data = pem.Decode(data); block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("invalid certificate #%d in %s: %w", count+1, fn, err)
+		}
+		pool.AddCert(cert)
+		count++
+	}
+	if count == 0 {
+		return nil, fmt.Errorf("no PEM encoded certificates found in %s", fn)
+	}
+	return pool, nil
+}
+
+// parse a local address, given as an IP or IP:port
+func parseLocalAddr(addr string) (*net.TCPAddr, error) {
+	if ip := net.ParseIP(addr); ip != nil {
+		return &net.TCPAddr{IP: ip}, nil
+	}
+	laddr, err := net.ResolveTCPAddr("tcp", addr)
+	if err != nil || laddr.IP == nil {
+		return nil, fmt.Errorf("invalid local address %s, should be <ip> or <ip>:<port>", addr)
+	}
+	return laddr, nil
+}
+
+// parse a SOCKS5 proxy address, given as [user[:password]@]host:port, into a proxy URL.
+// The standard transport speaks SOCKS5 for socks5:// proxy URLs
+func parseSOCKS5(addr string) (*url.URL, error) {
+	invalid := fmt.Errorf("invalid SOCKS5 proxy %s, should be [<user>[:<password>]@]<host>:<port>", addr)
+	if strings.Contains(addr, "://") {
+		if !strings.HasPrefix(addr, "socks5://") {
+			return nil, invalid
+		}
+		addr = strings.TrimPrefix(addr, "socks5://")
+	}
+
+	u := &url.URL{Scheme: "socks5", Host: addr}
+	if i := strings.LastIndex(addr, "@"); i >= 0 {
+		credentials, hostport := addr[:i], addr[i+1:]
+		user, password := credentials, ""
+		hasPassword := false
+		if j := strings.Index(credentials, ":"); j >= 0 {
+			user, password, hasPassword = credentials[:j], credentials[j+1:], true
+		}
+		if user == "" || len(user) > 255 || len(password) > 255 {
+			return nil, invalid
+		}
+		if hasPassword {
+			u.User = url.UserPassword(user, password)
+		} else {
+			u.User = url.User(user)
+		}
+		u.Host = hostport
+	}
+
+	host, port, err := net.SplitHostPort(u.Host)
+	if err != nil || host == "" {
+		return nil, invalid
+	}
+	if p, err := strconv.Atoi(port); err != nil || p <= 0 || p > 65535 {
+		return nil, invalid
+	}
+	return u, nil
+}
+
+// parse a comma separated list of hex encoded SHA256 fingerprints, optionally colon separated
+func parseFingerprints(value string) ([][]byte, error) {
+	var pins [][]byte
+	for _, fp := range strings.Split(value, ",") {
+		pin, err := hex.DecodeString(strings.ReplaceAll(strings.TrimSpace(fp), ":", ""))
+		if err != nil || len(pin) != sha256.Size {
+			return nil, fmt.Errorf("invalid certificate fingerprint %s, should be a hex encoded SHA256 digest", fp)
+		}
+		pins = append(pins, pin)
+	}
+	return pins, nil
+}
+
+// accept the connection only if a certificate presented by the server matches a pinned
+// fingerprint. Any certificate in the chain may match, so pinning an intermediate CA
+// covers the different hosts asset downloads are redirected to
+func verifyPinnedCertificate(rawCerts [][]byte, pins [][]byte) error {
+	for _, raw := range rawCerts {
+		fp := sha256.Sum256(raw)
+		for _, pin := range pins {
+			if bytes.Equal(fp[:], pin) {
+				return nil
+			}
+		}
+	}
+	return errors.New("server certificate doesn't match any pinned fingerprint")
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// returned when the user declines changing the configured kernel, before anything is changed
+var errKernelChangeDeclined = errors.New("kernel change declined")
+
+// place the downloaded kernel copy at its destination and, when installing, configure WSL to
+// use it. Everything that can be checked is validated before the file is placed, so that the
+// only possible inconsistency is a failed configuration write, which is then reported along
+// with the change needed to reconcile the configuration with the placed file
+func placeKernel(ctx context.Context, copy, destination, local, dir string) error {
+	if *noClobber {
+		if _, err := os.Lstat(destination); err == nil {
+			return fmt.Errorf("destination %s already exists, not overwriting it", destination)
+		}
+	}
+
+	kernel := installedKernel(destination)
+	if *autoInstall {
+		if *installPath != "" {
+			if _, err := os.Stat(kernel); kernel != destination && err != nil {
+				return fmt.Errorf("invalid install path: %w", err)
+			}
+		}
+		if _, err := wslConfigFilePath(); err != nil {
+			return fmt.Errorf("unable to locate WSL configuration: %w", err)
+		}
+		if installing() && local != "" && configValue(local) != configValue(kernel) && interactive() {
+			notice("changing the configured kernel from", local, "to", kernel)
+			ok, err := confirm("update " + wslConfigFile + "?")
+			if err != nil {
+				return err
+			}
+			if !ok {
+				return errKernelChangeDeclined
+			}
+		}
+		if *preHook != "" { // the hook validates the image before anything is changed
+			if err := runHook(ctx, "pre-install hook", *preHook, []string{copy}); err != nil {
+				return fmt.Errorf("not installing kernel: %w", err)
+			}
+		}
+		if *keepPrev && local != kernel && installing() {
+			if err := recordPreviousKernel(dir, local); err != nil {
+				return err
+			}
+		}
+	}
+
+	var copied string // digest before placing the copy, rechecked once placed
+	if *verifyCopy {
+		var err error
+		if copied, err = sha1sum(copy); err != nil {
+			return err
+		}
+	}
+	place := os.Rename
+	if *copyImage {
+		place = copyFile
+	}
+	if err := place(copy, destination); err != nil {
+		return err
+	}
+	if *verifyCopy {
+		placed, err := sha1sum(destination)
+		if err == nil && placed != copied {
+			err = fmt.Errorf("placed kernel %s digest %s doesn't match the downloaded %s", destination, placed, copied)
+		}
+		if err != nil {
+			os.Remove(destination)
+			return fmt.Errorf("kernel image verification failed, removed it: %w", err)
+		}
+		verbose("verified placed kernel digest", placed)
+	}
+	if !*autoInstall {
+		return nil
+	}
+
+	if err := wslConfigSetKernel(kernel); err != nil {
+		cfg, _ := wslConfigFilePath()
+		return fmt.Errorf("new kernel placed at %s but %s was not updated (%v): set '%s = %s' in its [%s] section to use it",
+			destination, cfg, err, wsl2KernelKey, configValue(kernel), wsl2Section)
+	}
+	if *installTo != "" {
+		notice("configuration using new kernel written to", *installTo)
+		return nil
+	}
+	notice("WSL configured to use new kernel --- requires a reboot")
+	return nil
+}
+
+// point the configuration at an existing kernel image, then read it back to confirm the
+// configured value resolves to the same file
+func setConfiguredKernel(kernel string) error {
+	fi, err := os.Stat(kernel)
+	if err != nil {
+		return fmt.Errorf("kernel can't be configured: %w", err)
+	}
+	if !fi.Mode().IsRegular() {
+		return fmt.Errorf("kernel can't be configured: %s is not a regular file", kernel)
+	}
+	if kernel, err = filepath.Abs(kernel); err != nil { // WSL resolves the path without a working directory
+		return err
+	}
+	if err = wslConfigSetKernel(kernel); err != nil {
+		return err
+	}
+	if *installTo != "" { // nothing to read back from the real configuration
+		return nil
+	}
+	configured, err := wslConfigGetKernelPath()
+	if err != nil {
+		return fmt.Errorf("failed to read back the configured kernel: %w", err)
+	}
+	if configValue(configured) != configValue(kernel) { // compared as written
+		return fmt.Errorf("configured kernel %s does not match %s", configured, kernel)
+	}
+	return nil
+}
+
+// returns true when installing changes the WSL configuration in place, rather than only
+// writing the updated configuration to -install-to for inspection
+func installing() bool {
+	return *autoInstall && *installTo == ""
+}
+
+// check files can be created in the directory
+func checkWritableDir(dir string) error {
+	f, err := ioutil.TempFile(dir, ".write-check-*")
+	if err != nil {
+		return fmt.Errorf("directory %s is not writable: %w", dir, err)
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// returns the kernel path configured when installing the image placed at destination
+func installedKernel(destination string) string {
+	if *installPath != "" {
+		return path.Clean(*installPath)
+	}
+	return destination
+}
+
+// maximal Windows path length (MAX_PATH, less the terminating NUL) unless long paths are enabled
+const maxWindowsPath = 259
+
+// warn if the Windows form of the destination exceeds the Windows path length limit, as
+// writing it (or WSL loading it) would later fail with a confusing error
+func checkPathLength(destination string) {
+	var p string
+	switch {
+	case runtime.GOOS == "windows":
+		abs, err := filepath.Abs(destination)
+		if err != nil {
+			return
+		}
+		p = abs
+	case strings.HasPrefix(destination, "/mnt/"): // a Windows drive accessed from WSL
+		p = strings.ReplaceAll(windowsPath(destination), `\\`, `\`)
+	default:
+		return
+	}
+	if len(p) > maxWindowsPath {
+		warn(fmt.Sprintf("destination path %s is %d characters long, exceeding the Windows limit of %d: "+
+			"shorten -dir (or use -plain-name) or enable Windows long path support", p, len(p), maxWindowsPath))
+	}
+}
+
+// check WSL2 is in use, since the kernel configuration has no effect on WSL1 distributions.
+// The check is skipped when WSL can't be queried (e.g., when configuring a mounted home)
+func checkWSL2(ctx context.Context) error {
+	ok, err := wslHasVersion2Distro(ctx)
+	if err != nil {
+		verbose("skipping WSL2 check:", err)
+		return nil
+	}
+	if ok {
+		return nil
+	}
+	msg := "no WSL2 distribution found, the configured kernel is only used by WSL2"
+	if *force {
+		warn(msg)
+		return nil
+	}
+	return fmt.Errorf("%s (use -force to install anyway)", msg)
+}
+
+// copy the source file to the destination, removing a partially written destination on failure
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(dst)
+		return fmt.Errorf("failed to copy %s to %s: %w", src, dst, err)
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestPlaceKernelConfigWriteFailure(t *testing.T) {
+	dir := tempDir(t)
+	setBool(t, autoInstall, true)
+	setString(t, windowsHome, dir)
+	// a directory in place of .wslconfig fails the configuration write, even when run as root
+	if err := os.Mkdir(path.Join(dir, wslConfigFile), 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, dir, "download")
+	copy, destination := path.Join(dir, "download"), path.Join(dir, "bzImage.5.10")
+
+	err := placeKernel(context.Background(), copy, destination, "", dir)
+	if err == nil {
+		t.Fatal("placeKernel() succeeded despite failing to write the configuration")
+	}
+	if _, serr := os.Stat(destination); serr != nil {
+		t.Errorf("placed kernel removed: %v", serr)
+	}
+	fix := "set '" + wsl2KernelKey + " = " + windowsPath(destination) + "' in its [" + wsl2Section + "] section"
+	if !strings.Contains(err.Error(), fix) {
+		t.Errorf("placeKernel() error = %v, want the fix %q", err, fix)
+	}
+}
+
+func TestCopyFile(t *testing.T) {
+	dir := tempDir(t)
+	writeFiles(t, dir, "bzImage")
+	src, dst := path.Join(dir, "bzImage"), path.Join(dir, "bzImage.copy")
+	if err := copyFile(src, dst); err != nil {
+		t.Fatalf("copyFile() error = %v", err)
+	}
+	if b, err := ioutil.ReadFile(dst); err != nil || string(b) != "bzImage" {
+		t.Errorf("copied file = %q, %v, want %q", b, err, "bzImage")
+	}
+	if _, err := os.Stat(src); err != nil {
+		t.Errorf("copyFile() removed the source: %v", err)
+	}
+}
+
+func TestCopyFileFailureRemovesPartialCopy(t *testing.T) {
+	dir := tempDir(t)
+	// a directory opens, but fails once read, after the destination was created
+	src, dst := path.Join(dir, "src"), path.Join(dir, "dst")
+	if err := os.Mkdir(src, 0755); err != nil {
+		t.Fatal(err)
+	}
+	err := copyFile(src, dst)
+	if err == nil || !strings.Contains(err.Error(), "failed to copy") {
+		t.Fatalf("copyFile() error = %v, want a copy failure", err)
+	}
+	if _, err = os.Stat(dst); !os.IsNotExist(err) {
+		t.Errorf("partial copy %s not removed: %v", dst, err)
+	}
+}
+
+func TestSetConfiguredKernel(t *testing.T) {
+	setBool(t, assumeYes, true)
+	dir := tempDir(t)
+	setString(t, windowsHome, dir)
+	writeFiles(t, dir, "bzImage")
+
+	if err := setConfiguredKernel(path.Join(dir, "bzImage")); err != nil {
+		t.Fatalf("setConfiguredKernel() error = %v", err)
+	}
+	b, err := ioutil.ReadFile(path.Join(dir, wslConfigFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "kernel = " + windowsPath(path.Join(dir, "bzImage")); !strings.Contains(string(b), want) {
+		t.Errorf("saved configuration = %q, want %q", b, want)
+	}
+	if err = setConfiguredKernel(path.Join(dir, "missing")); err == nil {
+		t.Error("setConfiguredKernel() of a missing kernel succeeded")
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// file, in the download directory, recording the time of the last successful run
+const lastRunFile = ".last-run"
+
+// returns the time of the last successful run, or the zero time if none is recorded
+func lastRun(dir string) (time.Time, error) {
+	b, err := ioutil.ReadFile(path.Join(dir, lastRunFile))
+	if os.IsNotExist(err) {
+		return time.Time{}, nil
+	} else if err != nil {
+		return time.Time{}, err
+	}
+	return time.Parse(time.RFC3339, strings.TrimSpace(string(b)))
+}
+
+// record the current time as that of the last successful run
+func recordRun(dir string) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+	return ioutil.WriteFile(path.Join(dir, lastRunFile), []byte(now+"\n"), 0644)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+)
+
+// destination of informational messages
+var infoOut io.Writer = os.Stdout
+
+// destination of the error a run fails with
+var errOut io.Writer = os.Stderr
+
+// print a message reporting a change in state or a failure, even in quiet mode
+func notice(a ...interface{}) {
+	fmt.Fprintln(infoOut, a...)
+}
+
+// print an informational progress message, suppressed in quiet mode
+func info(a ...interface{}) {
+	if !*quiet {
+		fmt.Fprintln(infoOut, a...)
+	}
+}
+
+// print a formatted informational progress message, suppressed in quiet mode
+func infof(format string, a ...interface{}) {
+	if !*quiet {
+		fmt.Fprintf(infoOut, format, a...)
+	}
+}
+
+// print a warning message, even in quiet mode
+func warn(a ...interface{}) {
+	fmt.Fprintln(infoOut, append([]interface{}{"warning:"}, a...)...)
+}
+
+// print a verbose message, only when enabled
+func verbose(a ...interface{}) {
+	if *verboseLog {
+		fmt.Fprintln(infoOut, a...)
+	}
+}
+
+// tee messages to the named log file, rotating it at maxSize bytes
+func teeLogFile(name string, maxSize int64, backups int) error {
+	rf, err := openRotatingFile(name, maxSize, backups)
+	if err != nil {
+		return err
+	}
+	infoOut = io.MultiWriter(infoOut, rf)
+	errOut = io.MultiWriter(errOut, rf)
+	return nil
+}
+
+// print an error prefixed with the program name: only its root cause or, in full, each
+// error along the chain of wrapped errors
+func printError(err error, full bool) {
+	prog := filepath.Base(os.Args[0])
+	if !full {
+		fmt.Fprintf(errOut, "%s: %v\n", prog, rootCause(err))
+		return
+	}
+	fmt.Fprintf(errOut, "%s: %v\n", prog, err)
+	for e := err; e != nil; e = errors.Unwrap(e) {
+		fmt.Fprintf(errOut, "  %T: %v\n", e, e)
+	}
+}
+
+// returns the innermost wrapped error along with the context added by the error wrapping it
+// (e.g., 'pre-install hook failed: exit status 1'). Unwrapping stops at file and URL errors,
+// since they already say what failed
+func rootCause(err error) error {
+	var parent error
+	for {
+		switch err.(type) {
+		case *os.PathError, *os.LinkError, *os.SyscallError, *url.Error:
+			// already says what failed
+		default:
+			if next := errors.Unwrap(err); next != nil {
+				parent, err = err, next
+				continue
+			}
+		}
+		if parent != nil {
+			return parent
+		}
+		return err
+	}
+}
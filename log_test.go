@@ -0,0 +1,34 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestRootCause(t *testing.T) {
+	exitStatus := errors.New("exit status 1")
+	notExist := &os.PathError{Op: "open", Path: "/k/bzImage", Err: os.ErrNotExist}
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"unwrapped", exitStatus, "exit status 1"},
+		{"hook failure", fmt.Errorf("not installing kernel: %w", fmt.Errorf("pre-install hook failed: %w", exitStatus)),
+			"pre-install hook failed: exit status 1"},
+		{"since tag", fmt.Errorf("listing releases: %w", fmt.Errorf("release tagged v1 not found in o/r: %w", errors.New("404 Not Found"))),
+			"release tagged v1 not found in o/r: 404 Not Found"},
+		{"file error", fmt.Errorf("checking: %w", fmt.Errorf("failed to read plan: %w", notExist)),
+			"failed to read plan: open /k/bzImage: file does not exist"},
+		{"bare file error", notExist, "open /k/bzImage: file does not exist"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rootCause(tt.err).Error(); got != tt.want {
+				t.Errorf("rootCause() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
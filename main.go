@@ -2,122 +2,739 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
-	"io"
 	"os"
 	"path"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
 )
 
 var (
 	repository  = flag.String("github-repo", "nathanchance/WSL2-Linux-Kernel", "WSL2 kernel source repository on github")
 	downloads   = flag.String("dir", "", "directory used for downloaded kernel image, overrides .wslconfig value if defined")
+	configOnly  = flag.Bool("dir-from-config-only", false, "only download to the directory of the kernel set in .wslconfig, failing if none is set")
+	noDefault   = flag.Bool("no-default-dir", false, "fail, instead of using ~/wsl2-kernels, when neither -dir nor a .wslconfig kernel are set")
+	outPath     = flag.String("o", "", "full path of the downloaded kernel image, overrides -dir and the image file name")
 	imageName   = flag.String("image-name", "bzImage", "kernel image name in release")
+	imageTmpl   = flag.String("image-name-template", "", "Go template rendering the image name in each release (e.g., 'bzImage-{{.Tag}}'), overrides -image-name")
+	assetID     = flag.Int64("asset-id", 0, "ID of the image asset to download when a release has several assets with the same name")
 	byTag       = flag.String("tag", "", "download a specific release based on its tag, instead of 'latest'")
 	tagImage    = flag.Bool("tag-image", true, "use 'release.tag_name' as image file extension")
+	nameFormat  = flag.String("name-template", "", "Go template naming downloaded images (fields: .Repository .Tag .Asset .SHA .ShortSHA .Date .Published), overrides -tag-image; such images are found for -keep and -clean by their .meta.json file")
+	plainName   = flag.Bool("plain-name", false, "save the image using its plain release name, same as -tag-image=false")
 	autoInstall = flag.Bool("install", false, "auto-install kernel to WSL2 -- requires WSL reboot!")
+	installNew  = flag.Bool("install-if-newer", false, "like -install, but only if the kernel version is newer than the configured kernel's")
+	tagsOnly    = flag.Bool("list-tags", false, "list release tags only, newest first and one per line")
+	limit       = flag.Int("limit", 30, "maximum number of tags listed with -list-tags (0 for all)")
 	listOnly    = flag.Bool("list", false, "list recent releases, without downloading anything")
+	keepPrev    = flag.Bool("keep-previous", false, "on install, record the previously configured kernel so it can be restored with -rollback")
+	rollback    = flag.Bool("rollback", false, "restore the kernel configured before the last install with -keep-previous")
+	modAsset    = flag.String("modules-asset", "", "release asset holding a kernel modules tarball (.tar.gz), extracted on install")
+	modRoot     = flag.String("modules-root", "", "mounted distribution root to extract kernel modules into, instead of extracting inside WSL")
+	modDistro   = flag.String("modules-distro", "", "WSL distribution to extract kernel modules in, defaults to the default distribution")
+	copyImage   = flag.Bool("copy", false, "copy the downloaded image to its destination, instead of moving it")
+	keepTemp    = flag.Bool("keep-temp", false, "keep the temporary downloaded image (e.g., for inspection), requires -copy to be kept once placed")
+	verifyCopy  = flag.Bool("verify-after-copy", false, "recompute the digest of the placed kernel image, removing it if it differs from the downloaded copy")
+	noClobber   = flag.Bool("no-clobber", false, "refuse to overwrite an existing kernel image at the destination")
+	preHook     = flag.String("pre-install-hook", "", "command validating the downloaded image, given its path, before installing it; install only if it succeeds")
+	postHook    = flag.String("post-install-hook", "", "command run after a successful install, given the kernel path and release tag (also as $WSL2_KERNEL and $WSL2_KERNEL_TAG)")
+	hookTimeout = flag.Duration("hook-timeout", 5*time.Minute, "time limit for each install hook command, 0 for no limit")
+	validateCfg = flag.Bool("validate-config", false, "check the [wsl2] section of .wslconfig for common mistakes (missing kernel, invalid sizes, unknown keys)")
+	setKernelTo = flag.String("set-kernel", "", "only point .wslconfig at this existing kernel image, without checking GitHub")
+	installTo   = flag.String("install-to", "", "with -install or -set-kernel, write the updated .wslconfig to this file instead, for inspection")
+	installPath = flag.String("install-path", "", "kernel path written to .wslconfig on install, instead of the download destination")
+	checksumAst = flag.String("verify-checksum", "", "release asset listing image checksums (e.g., SHA256SUMS) to verify the download against, for every algorithm listed")
+	checksumURL = flag.String("checksum-url", "", "verify the downloaded image against the checksum for it published at this URL")
+	digestFile  = flag.String("digest-file", "", "write the downloaded image digest to the named file, formatted as '<algo>:<hex>  <filename>'")
+	planFile    = flag.String("plan-file", "", "write the update plan as JSON to this file for review, without saving anything (the image is read to compute its digest unless GitHub publishes one)")
+	applyFile   = flag.String("apply-plan", "", "apply an update plan previously written with -plan-file, if still current")
+	checkOnly   = flag.Bool("check", false, "check whether an update to the configured kernel is available, without saving anything")
+	verifyOnly  = flag.String("verify-only", "", "only verify the given file matches the release asset, without downloading it into place")
+	remoteSum   = flag.Bool("remote-digest", false, "print the remote image digest and tag, without saving the image")
+	scanLimit   = flag.Int("scan-limit", 50, "maximum number of releases to examine when searching for a matching release (0 for no limit)")
+	before      = flag.String("before", "", "select the newest release published before this date (YYYY-MM-DD or RFC3339)")
+	atCommit    = flag.String("at-commit", "", "select the newest release targeting this commit SHA (or SHA prefix)")
+	nameMatch   = flag.String("name-match", "", "select the newest release whose name (title) contains this substring")
+	drafts      = flag.Bool("include-drafts", false, "consider draft releases when selecting the latest release -- requires a token")
+	printTag    = flag.Bool("print-latest-tag", false, "print only the latest (or -tag selected) release tag, other messages go to stderr")
+	toMemory    = flag.Bool("to-memory", false, "download the image into memory and write it to stdout (e.g., for piping), other messages go to stderr")
+	printPath   = flag.Bool("print-path", false, "print only the path of a newly downloaded image, other messages go to stderr")
+	printURL    = flag.Bool("print-url", false, "print the release image download URL and asset ID, without downloading anything")
+	runningVer  = flag.Bool("running-version", false, "show the kernel version WSL2 is running, compared to the configured and latest kernels")
+	sinceTag    = flag.String("since-tag", "", "with -list, only list releases newer than the release with this tag")
+	showSize    = flag.Bool("show-size", false, "with -list, show the size of each release's image asset")
+	showDL      = flag.Bool("show-downloads", false, "with -list, list the assets of each release with their download counts")
+	perMajor    = flag.Bool("latest-per-major", false, "with -list, only list the newest release of each major.minor kernel line")
+	backupKeep  = flag.Int("backup-keep", 0, "back up .wslconfig to a timestamped file before changing it, keeping this many recent backups (0 for no backups)")
+	windowsHome = flag.String("windows-home", "", "Windows user home (e.g., a mounted /mnt/c/Users/me) holding .wslconfig, forces Windows formatted kernel path")
+	repoFile    = flag.String("repo-file", "", "file listing repositories ('<user>/<repo> [image-name]' lines) to check, each downloaded into its own subdirectory")
+	allowedRepo = flag.String("allowed-repos", "", "comma separated list of trusted repositories, defaults to well known WSL2 kernel repositories")
+	allowAny    = flag.Bool("allow-any-repo", false, "allow downloading from repositories not in the trusted list")
+	token       = flag.String("token", "", "GitHub token used to authenticate API requests, overrides -token-file and $GITHUB_TOKEN")
+	appID       = flag.Int64("app-id", 0, "GitHub App ID, to authenticate as an app installation instead of with a token")
+	appInstall  = flag.Int64("app-installation-id", 0, "GitHub App installation ID, used with -app-id")
+	appKey      = flag.String("app-key", "", "GitHub App private key PEM file, used with -app-id")
+	whoamiOnly  = flag.Bool("whoami", false, "print the authenticated user (or anonymous) and remaining API rate limit, to test the token")
+	apiLimits   = flag.Bool("api-limits", false, "print the core and search GitHub API rate limits, remaining requests and reset times")
+	tokenFile   = flag.String("token-file", "", "file holding the GitHub token used to authenticate API requests")
+	format      = flag.String("format", "", "Go template for listed releases and the run summary (fields: .Tag .Name .Asset .SHA .Size .Downloads .Published .Destination .Updated)")
+	dateFormat  = flag.String("date-format", "", "format of printed dates: a Go time layout (e.g., '2006-01-02 15:04'), 'rfc3339' or 'relative', defaults to YYYY-MM-DD")
+	output      = flag.String("output", "text", "format of the final run summary: text or json")
+	manifest    = flag.Bool("manifest", false, "print the digests of all kernel images in the download directory")
+	manifestAlg = flag.String("manifest-algo", sha256Algorithm, "manifest digest algorithm: sha1, sha256 or sha512")
+	keepImages  = flag.Int("keep", 0, "after an update, prune all but this many recent kernel images in the download directory (0 keeps all)")
+	clean       = flag.Bool("clean", false, "remove all kernel images in the download directory, except the configured and -keep-previous ones, after confirmation")
+	assumeYes   = flag.Bool("yes", false, "answer yes to confirmation prompts")
+	pruneDryRun = flag.Bool("prune-dry-run", false, "list the kernel images -keep would prune and keep, without deleting anything")
+	verifyVer   = flag.Bool("verify-version", false, "verify the kernel version embedded in the image matches the release tag")
+	alwaysDL    = flag.Bool("always-download", false, "download and write the latest image even if its digest matches the local kernel")
+	minAge      = flag.Duration("min-age", 0, "skip releases published more recently than this duration (e.g., 72h), allowing time for a bad release to be pulled")
+	minInterval = flag.Duration("min-interval", 0, "skip the update if the last successful run was more recent than this duration, unless -force")
+	archFlag    = flag.String("arch", "", "prefer the image asset labeled or named for this architecture (e.g., arm64), or 'auto' for the host's")
+	force       = flag.Bool("force", false, "proceed despite failed safety checks (e.g., architecture mismatch)")
+	debug       = flag.Bool("debug", false, "print the full chain of wrapped errors on failure, instead of only the root cause and its context")
+	verboseLog  = flag.Bool("v", false, "print verbose messages")
+	fixtureFile = flag.String("fixture", "", "read releases and assets from this JSON fixture file instead of GitHub (e.g., for offline testing)")
+	etagCache   = flag.String("etag-cache", "", "file caching GitHub API responses, to avoid refetching unchanged release metadata")
+	archive     = flag.Bool("archive", false, "save the release metadata (tag, date, notes, assets and image digest) as JSON next to each downloaded image")
+	auditLog    = flag.String("audit-log", "", "append a JSON line describing each successful download or install to this file")
+	logFile     = flag.String("log-file", "", "also write messages to this log file")
+	logMaxSize  = flag.Int64("log-max-size", 10<<20, "rotate the log file once it reaches this size in bytes")
+	logBackups  = flag.Int("log-backups", 3, "number of rotated log files to keep")
+	quiet       = flag.Bool("quiet", false, "only print messages when a new kernel is downloaded or installed, or on errors")
+	httpTimeout = flag.Duration("http-timeout", 0, "time limit for each HTTP request, including reading the response (e.g., a whole download), 0 for no limit")
+	localAddr   = flag.String("local-addr", "", "local IP address (or IP:port) to download assets from, e.g., to use a specific network interface")
+	socks5      = flag.String("socks5", "", "connect through a SOCKS5 proxy, given as [user[:password]@]host:port")
+	caCert      = flag.String("ca-cert", "", "PEM file of additional trusted CA certificates (e.g., of a TLS intercepting proxy)")
+	pinCert     = flag.String("pin-cert", "", "comma separated SHA256 fingerprints of trusted server (or CA) certificates, aborting connections on mismatch")
+	rateLimit   = flag.String("rate-limit", "", "limit the bandwidth of each download to this many bytes per second (e.g., 512K or 2M)")
+	retries     = flag.Int("retries", 2, "number of times to retry a download interrupted while reading")
+	parallel    = flag.Int("parallel", 4, "maximal number of concurrent downloads or digest computations")
+	skipTags    stringList
+	extraAssets stringList
+	beforeTime  time.Time
+	byteRate    int64
+	assetTmpl   *template.Template
+	nameTmpl    *template.Template
 )
 
+func init() {
+	flag.Var(&skipTags, "skip-tag", "never download the release with this tag (can be repeated)")
+	flag.Var(&extraAssets, "asset", "additional release asset to download alongside a new kernel image (can be repeated)")
+}
+
 func main() {
 	flag.Parse()
+	if err := setFlagsFromEnv(flag.CommandLine, flagsEnvPrefix); err != nil {
+		exit(err)
+	}
+	if *printTag || *printPath || *toMemory {
+		infoOut = os.Stderr // keep stdout for the tag, path or image only
+	}
+	if *logFile != "" {
+		if err := teeLogFile(*logFile, *logMaxSize, *logBackups); err != nil {
+			exit(err)
+		}
+	}
+
+	if *installNew {
+		*autoInstall = true
+	}
+
+	if err := checkRepository(*repository); err != nil {
+		exit(err)
+	}
+
+	if *before != "" {
+		var err error
+		if beforeTime, err = parseDate(*before); err != nil {
+			exit(err)
+		}
+	}
+
+	if *imageTmpl != "" {
+		var err error
+		if assetTmpl, err = template.New("image-name").Parse(*imageTmpl); err != nil {
+			exit(fmt.Errorf("invalid -image-name-template: %w", err))
+		}
+	}
+
+	if *rateLimit != "" {
+		var err error
+		if byteRate, err = parseByteRate(*rateLimit); err != nil {
+			exit(err)
+		}
+	}
+
+	if *nameFormat != "" {
+		var err error
+		if nameTmpl, err = parseNameTemplate(*nameFormat); err != nil {
+			exit(fmt.Errorf("invalid -name-template: %w", err))
+		}
+	}
+
+	formatTmpl, err := parseFormat(*format)
+	if err != nil {
+		exit(fmt.Errorf("invalid -format template: %w", err))
+	}
+
+	if *validateCfg {
+		if err := validateConfig(); err != nil {
+			exit(err)
+		}
+		return
+	}
+
+	if *setKernelTo != "" {
+		if err := setConfiguredKernel(*setKernelTo); err != nil {
+			exit(err)
+		}
+		if *installTo != "" {
+			notice("configuration using kernel", *setKernelTo, "written to", *installTo)
+		} else {
+			notice("WSL configured to use kernel", *setKernelTo, "--- requires a reboot")
+		}
+		return
+	}
+
+	t, err := ghToken(*token, *tokenFile)
+	if err != nil {
+		exit(err)
+	}
+	if err = configureHTTP(t); err != nil {
+		exit(err)
+	}
+	if *drafts && t == "" && *appID == 0 {
+		warn("draft releases are only visible with an authentication token")
+	}
+
+	if *whoamiOnly {
+		if err := whoami(context.Background(), t != "" || *appID != 0, *appInstall); err != nil {
+			exit(err)
+		}
+		return
+	}
+
+	if *apiLimits {
+		if err := printRateLimits(context.Background(), t != "" || *appID != 0); err != nil {
+			exit(err)
+		}
+		return
+	}
 
 	if *listOnly {
 		fmt.Println("available releases:")
 		ctx := context.Background()
-		if err := listReleases(ctx, *repository); err != nil {
+		if err := listReleases(ctx, *repository, listOptions{
+			latestPerMajor: *perMajor,
+			format:         formatTmpl,
+			imageName:      *imageName,
+			sinceTag:       *sinceTag,
+			showDownloads:  *showDL,
+			showSize:       *showSize,
+		}); err != nil {
+			exit(err)
+		}
+		return
+	}
+
+	if *tagsOnly {
+		if err := listTags(context.Background(), *repository, *limit); err != nil {
+			exit(err)
+		}
+		return
+	}
+
+	if *printTag {
+		release, err := resolveRelease(context.Background(), *repository, flagsReleaseQuery())
+		if err != nil {
+			exit(err)
+		}
+		fmt.Println(release.GetTagName())
+		return
+	}
+
+	if *printURL {
+		ra, err := resolveAsset(context.Background(), *repository, flagsReleaseQuery(), *imageName)
+		if err != nil {
+			exit(err)
+		}
+		fmt.Println(ra.DownloadURL, ra.ID)
+		return
+	}
+
+	if *toMemory {
+		if err := writeImageToStdout(context.Background()); err != nil {
+			exit(err)
+		}
+		return
+	}
+
+	if *verifyOnly != "" {
+		if err := verifyAgainstRelease(context.Background(), *verifyOnly); err != nil {
+			exit(err)
+		}
+		return
+	}
+
+	if *remoteSum {
+		if err := printRemoteDigest(context.Background()); err != nil {
 			exit(err)
 		}
 		return
 	}
 
 	local, err := wslConfigGetKernelPath()
+	if errors.Is(err, errNoHomeDirectory) && (*checkOnly || *runningVer) {
+		// read-only modes don't need the home directory, only the configured kernel
+		warn(err.Error() + ", assuming no kernel is configured (use -windows-home to set it)")
+		err = nil
+	}
 	if err != nil && !os.IsNotExist(err) {
 		exit(err)
 	}
 
-	if *downloads == "" { // target download directory is not set
-		if local != "" {
-			*downloads = path.Dir(local)
-		} else { // not set and not defined in wslconfig, use default directory '~/wsl2-kernels'
-			const defaultKernelDir = "wsl2-kernels"
-			home, err := userHomeDirectory()
-			if err != nil {
+	if *checkOnly {
+		err := checkForUpdate(context.Background(), local)
+		if errors.Is(err, errNoKernelConfigured) { // already reported, only the exit code differs
+			os.Exit(exitNoKernel)
+		} else if err != nil {
+			exit(err)
+		}
+		return
+	}
+
+	if *runningVer {
+		if err := showRunningVersion(context.Background(), local); err != nil {
+			exit(err)
+		}
+		return
+	}
+
+	if *configOnly && (*downloads != "" || *outPath != "") {
+		exit(errors.New("-dir-from-config-only can't be combined with -dir or -o"))
+	}
+	if *outPath != "" {
+		*outPath = filepath.Clean(*outPath) // native separators, e.g., backslashes on Windows
+		*downloads = filepath.Dir(*outPath)
+		if *planFile == "" { // plans are written without saving anything
+			if err = os.MkdirAll(*downloads, 0755); err != nil {
 				exit(err)
 			}
-			*downloads = path.Join(home, defaultKernelDir)
-			if _, err = os.Stat(*downloads); os.IsNotExist(err) {
-				fmt.Println("creating download directory for kernel images:", *downloads)
-				if err = os.Mkdir(*downloads, 0755); err != nil {
-					exit(err)
-				}
+			if err = checkWritableDir(*downloads); err != nil {
+				exit(err)
 			}
 		}
 	}
 
+	if *downloads, err = downloadDirectory(*downloads, local); err != nil {
+		exit(err)
+	}
+
+	if *rollback {
+		kernel, err := rollbackKernel(*downloads)
+		if err != nil {
+			exit(err)
+		}
+		notice("WSL configured to use previous kernel", kernel, "--- requires a reboot")
+		return
+	}
+
+	if *repoFile != "" {
+		if err := updateRepositories(context.Background(), *repoFile, formatTmpl); err != nil {
+			exit(err)
+		}
+		return
+	}
+
+	if *manifest {
+		if err := printManifest(*downloads, *imageName, *manifestAlg, *parallel); err != nil {
+			exit(err)
+		}
+		return
+	}
+
+	if *clean {
+		if err := cleanImages(*downloads, *imageName, local); err != nil {
+			exit(err)
+		}
+		return
+	}
+
+	if *pruneDryRun {
+		if err := showPrunable(local); err != nil {
+			exit(err)
+		}
+		return
+	}
+
+	if *minInterval > 0 && !*force {
+		last, err := lastRun(*downloads)
+		if err != nil {
+			exit(fmt.Errorf("failed to read the last run time: %w", err))
+		}
+		if elapsed := time.Since(last); elapsed < *minInterval {
+			notice("last run was", elapsed.Round(time.Second), "ago, less than -min-interval", *minInterval, "(use -force to run anyway)")
+			return
+		}
+	}
+
 	localSHA := emptySHA1
 	if local != "" {
 		localSHA, err = sha1sum(local)
-		fmt.Println("local kernel", local, "digest:", localSHA)
-		if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			warn("configured kernel", local, "does not exist")
+		} else if err != nil {
 			exit(err)
+		} else {
+			info("local kernel", local, "digest:", localSHA)
 		}
 	}
 
-	fmt.Println("downloading remote image from", *repository)
-	copy, remoteSHA, remoteTag, err := downloadCopyOfReleasedImage()
-	if err != nil {
-		exit(err)
+	ctx := context.Background()
+	target := updateTarget{repository: *repository, imageName: *imageName, dir: *downloads}
+	if *planFile != "" {
+		if err = writePlan(ctx, *planFile, target, local, localSHA); err != nil {
+			exit(err)
+		}
+		return
+	}
+	if *applyFile != "" {
+		if err = applyPlan(ctx, *applyFile, local, localSHA); err != nil {
+			exit(err)
+		}
+		return
 	}
 
-	fmt.Println("remote kernel tagged", remoteTag, "digest:", remoteSHA)
-	if remoteSHA != localSHA {
-		destination := path.Join(*downloads, *imageName)
-		if *tagImage {
-			destination = fmt.Sprintf("%s.%s", destination, remoteTag)
+	if installing() {
+		if err = checkWSL2(ctx); err != nil {
+			exit(err)
 		}
-		destination = path.Clean(destination)
+	}
 
-		fmt.Println("digests differ, copying new kernel to", destination)
-		if err = os.Rename(copy, destination); err != nil {
+	summary := newRunSummary()
+	defer func() {
+		if *printPath { // only the path goes to stdout, for scripts to act on
+			if summary.Updated {
+				fmt.Println(summary.Destination)
+			}
+			return
+		}
+		if *quiet && !summary.Updated {
+			return
+		}
+		if err := summary.print(*output, formatTmpl); err != nil {
 			exit(err)
 		}
-		if *autoInstall {
-			err = wslConfigSetKernel(destination)
-			if err != nil {
-				exit(err)
+	}()
+
+	if err = updateKernel(ctx, target, local, localSHA, summary); err != nil {
+		exit(err)
+	}
+	if *minInterval > 0 {
+		if err = recordRun(*downloads); err != nil {
+			warn("failed to record the run time:", err)
+		}
+	}
+}
+
+// check the repository is allowed by flags
+func checkRepository(repository string) error {
+	if *allowAny {
+		return nil
+	}
+	var allowed []string
+	if *allowedRepo != "" {
+		allowed = strings.Split(*allowedRepo, ",")
+	}
+	return ghCheckRepositoryAllowed(repository, allowed)
+}
+
+// returns the architecture whose image asset is preferred, empty if not set by -arch
+func assetArch() string {
+	if *archFlag == "" {
+		return ""
+	}
+	return hostArch()
+}
+
+// returns the release selection criteria set by flags
+func flagsReleaseQuery() releaseQuery {
+	return releaseQuery{
+		tag:           *byTag,
+		includeDrafts: *drafts,
+		before:        beforeTime,
+		commit:        *atCommit,
+		nameMatch:     *nameMatch,
+		assetTemplate: assetTmpl,
+		arch:          assetArch(),
+	}
+}
+
+// parse a date flag value, either as a date or as an RFC3339 timestamp
+func parseDate(value string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %s, should be YYYY-MM-DD or RFC3339", value)
+	}
+	return t, nil
+}
+
+// process exit codes
+const (
+	exitFailure  = 1
+	exitNotFound = 2 // the requested release doesn't exist
+	exitHookFail = 3 // the kernel was installed, but the post-install hook failed
+	exitNoKernel = 4 // -check found no kernel configured in .wslconfig
+	exitPartial  = 5 // some, but not all, of the -repo-file repositories failed
+)
+
+// returned by -check when no kernel is configured, so there's nothing to compare
+var errNoKernelConfigured = errors.New("no kernel configured")
+
+// print the error to stderr, prefixed with the program name, and exit with the code matching
+// it. Only the root cause of a wrapped error is printed, unless -debug shows the whole chain
+func exit(err error) {
+	printError(err, *debug)
+	os.Exit(exitCode(err))
+}
+
+// returns the download directory: dir if set, otherwise the directory of the configured
+// kernel or, without one, the default ~/wsl2-kernels. The directory is created if missing,
+// unless only writing a -plan-file
+func downloadDirectory(dir, local string) (string, error) {
+	if dir == "" { // target download directory is not set
+		if local != "" {
+			dir = kernelDir(local)
+		} else if *configOnly {
+			return "", errors.New("no kernel path set in .wslconfig and -dir-from-config-only disallows the default directory")
+		} else if *noDefault {
+			return "", errors.New("no kernel path set in .wslconfig and -no-default-dir disallows creating ~/wsl2-kernels, set -dir")
+		} else { // not set and not defined in wslconfig, use default directory '~/wsl2-kernels'
+			const defaultKernelDir = "wsl2-kernels"
+			home := *windowsHome
+			if home == "" {
+				var err error
+				if home, err = userHomeDirectory(); err != nil {
+					return "", err
+				}
+			}
+			dir = path.Join(home, defaultKernelDir)
+		}
+	}
+
+	// the directory may be missing however it was set (e.g., a stale .wslconfig kernel path)
+	if _, err := os.Stat(dir); os.IsNotExist(err) && *planFile == "" {
+		info("creating download directory for kernel images:", dir)
+		if err = os.MkdirAll(dir, 0755); err != nil {
+			return "", err
+		}
+	}
+	return dir, nil
+}
+
+// returns the exit code for a run failing with the error
+func exitCode(err error) int {
+	var notFound *releaseNotFoundError
+	if errors.As(err, &notFound) {
+		return exitNotFound
+	}
+	var hookFailed *postInstallHookError
+	if errors.As(err, &hookFailed) {
+		return exitHookFail
+	}
+	var partial *partialFailureError
+	if errors.As(err, &partial) {
+		return exitPartial
+	}
+	return exitFailure
+}
+
+// print the running WSL2 kernel version along with the configured and latest available kernels
+func showRunningVersion(ctx context.Context, local string) error {
+	running, err := wslRunningKernelVersion(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Println("running kernel version:", running)
+	rv, rok := parseKernelVersion(running)
+	if !rok {
+		warn("unable to parse the running kernel version", running)
+	}
+	if local != "" {
+		fmt.Println("configured kernel:", local)
+		if cv, ok := fileKernelVersion(local); rok && ok {
+			fmt.Println("running kernel", rv.relation(cv), "the configured kernel version", cv)
+			if rv.compare(cv) != 0 {
+				fmt.Println("restart WSL with 'wsl --shutdown' to boot the configured kernel")
 			}
-			fmt.Println("WSL configured to use new kernel --- requires a reboot")
 		}
 	} else {
-		fmt.Println("latest release already in", *downloads)
+		fmt.Println("configured kernel: WSL default")
+	}
+
+	release, _, err := getReleaseAsset(ctx, *repository, flagsReleaseQuery(), *imageName)
+	if err != nil {
+		return err
 	}
+	tag := release.GetTagName()
+	fmt.Println("latest available release:", tag)
+	if tv, ok := parseKernelVersion(tag); rok && ok {
+		fmt.Println("running kernel", rv.relation(tv), "the latest release")
+	}
+	return nil
 }
 
-func exit(err error) {
-	fmt.Println(err)
-	os.Exit(1)
+// stream the remote image through a hash function, printing its digest and release tag
+func printRemoteDigest(ctx context.Context) error {
+	ra, err := resolveAsset(ctx, *repository, flagsReleaseQuery(), *imageName)
+	if err != nil {
+		return err
+	}
+	digest, err := remoteDigest(ctx, *repository, ra.Asset)
+	if err != nil {
+		return err
+	}
+	fmt.Println("remote kernel tagged", ra.Tag, "digest:", digest)
+	return nil
 }
 
-// download a released image, returns the local copy path, release tag name and SHA1 digest
-func downloadCopyOfReleasedImage() (string, string, string, error) {
-	destination := path.Join(os.TempDir(), *imageName)
-	ctx := context.Background()
-	rc, releaseTag, err := getReleaseAsset(ctx, *repository, *byTag, *imageName)
-	defer rc.Close()
+// download the image into memory and, once verified against its published digest, if any,
+// write it to stdout
+func writeImageToStdout(ctx context.Context) error {
+	ra, err := resolveAsset(ctx, *repository, flagsReleaseQuery(), *imageName)
+	if err != nil {
+		return err
+	}
+	data, err := downloadToMemory(ctx, ra, maxMemoryDownload)
+	if err != nil {
+		return err
+	}
+	published, err := getReleaseAssetDigest(ctx, *repository, ra.Asset)
+	if err != nil {
+		verbose("unable to retrieve published asset digest:", err)
+	} else if published != "" {
+		if err = verifyDataDigest(ra.Name, data, published); err != nil {
+			return err
+		}
+		info("verified image against published digest", published)
+	}
+	info("writing release", ra.Tag, "image to stdout")
+	_, err = os.Stdout.Write(data)
+	return err
+}
+
+// verify the file matches the release asset, using the published digest when available
+// and otherwise the digest of a downloaded copy
+func verifyAgainstRelease(ctx context.Context, fn string) error {
+	if _, err := os.Stat(fn); err != nil {
+		return err
+	}
+	ra, err := resolveAsset(ctx, *repository, flagsReleaseQuery(), *imageName)
+	if err != nil {
+		return err
+	}
+	published, err := getReleaseAssetDigest(ctx, *repository, ra.Asset)
+	if err != nil {
+		verbose("unable to retrieve published asset digest:", err)
+	}
+	if published != "" {
+		if err = verifyDigest(fn, published); err != nil {
+			fmt.Println("mismatch:", fn, "differs from release", ra.Tag)
+			return err
+		}
+		fmt.Println("match:", fn, "matches release", ra.Tag, "digest:", published)
+		return nil
+	}
+
+	local, err := sha1sum(fn)
+	if err != nil {
+		return err
+	}
+	remote, err := remoteDigest(ctx, *repository, ra.Asset)
+	if err != nil {
+		return err
+	}
+	if local != remote {
+		fmt.Println("mismatch:", fn, "differs from release", ra.Tag)
+		return fmt.Errorf("sha1 digest mismatch for %s: expected %s, got %s", fn, remote, local)
+	}
+	fmt.Println("match:", fn, "matches release", ra.Tag, "digest:", sha1Algorithm+":"+remote)
+	return nil
+}
+
+// print whether an update to the configured kernel is available, without downloading it
+func checkForUpdate(ctx context.Context, local string) error {
+	if local == "" { // no digest to compare, only the latest release is of interest
+		ra, err := resolveAsset(ctx, *repository, flagsReleaseQuery(), *imageName)
+		if err != nil {
+			return err
+		}
+		fmt.Println("no kernel currently installed; latest available is", ra.Tag)
+		return errNoKernelConfigured
+	}
+	u := Updater{
+		Repository: *repository,
+		ImageName:  *imageName,
+		Query:      flagsReleaseQuery(),
+		Kernel:     local,
+	}
+	available, status, err := u.UpdateAvailable(ctx)
+	if err != nil {
+		return err
+	}
+	if available {
+		fmt.Println("update available: release", status.RemoteTag, "digest:", status.RemoteDigest)
+	} else {
+		fmt.Println("kernel is up to date with release", status.RemoteTag)
+	}
+	return nil
+}
 
-	out, err := os.Create(destination)
+// returns the target's kernel image selection for pruning, protecting the previous kernel
+// as well as the given kernels
+func prunableImages(t updateTarget, protected ...string) (pruneSet, error) {
+	previous, err := previousKernel(t.dir)
 	if err != nil {
-		return "", "", "", err
+		return pruneSet{}, err
 	}
-	_, err = io.Copy(out, rc)
-	out.Close()
+	return selectPrunable(t.dir, t.imageName, *keepImages, append(protected, previous)...)
+}
 
+// prune old kernel images from the target's download directory
+func pruneImages(t updateTarget, protected ...string) error {
+	ps, err := prunableImages(t, protected...)
 	if err != nil {
-		fmt.Println("unable to save downloaded image")
-		return "", "", "", err
+		return err
 	}
+	return prune(ps)
+}
 
-	digest, err := sha1sum(destination)
-	return destination, digest, releaseTag, err
+// print the kernel images that pruning would remove and keep
+func showPrunable(local string) error {
+	if *keepImages <= 0 {
+		return errors.New("-prune-dry-run requires -keep to be set")
+	}
+	ps, err := prunableImages(updateTarget{imageName: *imageName, dir: *downloads}, local)
+	if err != nil {
+		return err
+	}
+	for _, fn := range ps.keep {
+		if isProtected(fn, []string{local}) {
+			fmt.Println("keep  ", fn, "(in use)")
+		} else {
+			fmt.Println("keep  ", fn)
+		}
+	}
+	for _, fn := range ps.remove {
+		fmt.Println("remove", fn)
+	}
+	return nil
 }
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"os"
+	"path"
+	"testing"
+)
+
+func TestDownloadDirectoryMissingKernelDir(t *testing.T) {
+	setBool(t, quiet, true)
+	dir := tempDir(t)
+	setString(t, windowsHome, dir)
+	// e.g., a .wslconfig kernel path left behind after its directory was deleted
+	local := path.Join(dir, "kernels", "wsl2", "bzImage")
+
+	got, err := downloadDirectory("", local)
+	if err != nil {
+		t.Fatalf("downloadDirectory() error = %v", err)
+	}
+	if want := path.Dir(local); got != want {
+		t.Errorf("downloadDirectory() = %s, want %s", got, want)
+	}
+	if fi, err := os.Stat(got); err != nil || !fi.IsDir() {
+		t.Errorf("download directory not created: %v", err)
+	}
+}
+
+func TestDownloadDirectoryDefault(t *testing.T) {
+	setBool(t, quiet, true)
+	dir := tempDir(t)
+	setString(t, windowsHome, dir)
+
+	got, err := downloadDirectory("", "")
+	if err != nil || got != path.Join(dir, "wsl2-kernels") {
+		t.Errorf("downloadDirectory() = %s, %v, want the default directory", got, err)
+	}
+	setBool(t, noDefault, true)
+	if _, err = downloadDirectory("", ""); err == nil {
+		t.Error("downloadDirectory() with -no-default-dir succeeded")
+	}
+}
+
+func TestDownloadDirectoryPlanFile(t *testing.T) {
+	setBool(t, quiet, true)
+	dir := tempDir(t)
+	setString(t, windowsHome, dir)
+	setString(t, planFile, path.Join(dir, "plan.json"))
+
+	got, err := downloadDirectory("", "")
+	if want := path.Join(dir, "wsl2-kernels"); err != nil || got != want {
+		t.Errorf("downloadDirectory() = %s, %v, want %s", got, err, want)
+	}
+	if _, err = os.Stat(got); !os.IsNotExist(err) {
+		t.Errorf("download directory created for -plan-file: %v", err)
+	}
+}
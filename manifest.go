@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path"
+	"sort"
+	"sync"
+)
+
+// digest of a single file in a manifest
+type manifestEntry struct {
+	name   string
+	digest string
+	err    error
+}
+
+// compute the digests of all kernel images in dir, using at most parallel concurrent workers.
+// Entries are sorted by file name, regardless of the order in which hashing completes
+func buildManifest(dir, imageName, algorithm string, parallel int) ([]manifestEntry, error) {
+	if _, err := newHash(algorithm); err != nil {
+		return nil, err
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []manifestEntry
+	for _, fi := range imageFiles(files, imageName) {
+		entries = append(entries, manifestEntry{name: fi.Name()})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].name < entries[j].name })
+
+	if parallel < 1 {
+		parallel = 1
+	}
+	sem := make(chan struct{}, parallel)
+	var wg sync.WaitGroup
+	for i := range entries {
+		wg.Add(1)
+		go func(e *manifestEntry) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			h, _ := newHash(algorithm) // already validated
+			e.digest, e.err = fileDigest(path.Join(dir, e.name), h)
+		}(&entries[i])
+	}
+	wg.Wait()
+	return entries, nil
+}
+
+// print a manifest of the kernel images in dir, using the '<algo>:<hex>  <filename>' format
+func printManifest(dir, imageName, algorithm string, parallel int) error {
+	entries, err := buildManifest(dir, imageName, algorithm, parallel)
+	if err != nil {
+		return err
+	}
+	failed := 0
+	for _, e := range entries {
+		if e.err != nil {
+			notice(e.err)
+			failed++
+			continue
+		}
+		fmt.Printf("%s:%s  %s\n", algorithm, e.digest, e.name)
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to checksum %d of %d files", failed, len(entries))
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"time"
+
+	"github.com/google/go-github/v33/github"
+)
+
+// suffix of the sidecar file recording where a downloaded kernel image came from
+const metaSuffix = ".meta.json"
+
+// provenance of a downloaded kernel image
+type imageMeta struct {
+	Repository   string    `json:"repository"`
+	Tag          string    `json:"tag"`
+	Asset        string    `json:"asset"`
+	AssetID      int64     `json:"asset_id"`
+	AssetUpdated time.Time `json:"asset_updated"`
+	Digest       string    `json:"digest"`
+	Downloaded   time.Time `json:"downloaded"`
+}
+
+// returns the provenance of an image with the digest, downloaded from the release asset
+func newImageMeta(repository string, release *github.RepositoryRelease, asset *github.ReleaseAsset, digest string) imageMeta {
+	return imageMeta{
+		Repository:   repository,
+		Tag:          release.GetTagName(),
+		Asset:        asset.GetName(),
+		AssetID:      asset.GetID(),
+		AssetUpdated: asset.GetUpdatedAt().Time,
+		Digest:       digest,
+		Downloaded:   time.Now().UTC(),
+	}
+}
+
+// returns true if the image with the digest is recorded as downloaded from the asset
+func (m imageMeta) matches(repository string, asset *github.ReleaseAsset, digest string) bool {
+	return m.Repository == repository && m.AssetID == asset.GetID() &&
+		m.AssetUpdated.Equal(asset.GetUpdatedAt().Time) && m.Digest == digest
+}
+
+// write the sidecar metadata file of the image
+func writeImageMeta(fn string, m imageMeta) error {
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(fn+metaSuffix, append(b, '\n'), 0644)
+}
+
+// read the sidecar metadata file of the image
+func readImageMeta(fn string) (imageMeta, error) {
+	var m imageMeta
+	b, err := ioutil.ReadFile(fn + metaSuffix)
+	if err != nil {
+		return m, err
+	}
+	err = json.Unmarshal(b, &m)
+	return m, err
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/go-github/v33/github"
+)
+
+// download the kernel modules tarball of the release and extract it, either into the
+// mounted distribution root or by streaming it to tar running inside WSL
+func installModules(ctx context.Context, repository string, release *github.RepositoryRelease) error {
+	asset, err := findReleaseAsset(release, *modAsset)
+	if err != nil {
+		info("release", release.GetTagName(), "has no modules asset", *modAsset+", skipping modules install")
+		return nil
+	}
+
+	info("downloading kernel modules", asset.GetName())
+	result := downloadAssetToTemp(ctx, repository, asset)
+	if result.err != nil {
+		return fmt.Errorf("failed to download modules: %w", result.err)
+	}
+	defer os.Remove(result.path)
+
+	if *modRoot != "" {
+		info("extracting kernel modules into", *modRoot)
+		return extractTarGz(result.path, *modRoot)
+	}
+
+	f, err := os.Open(result.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	args := []string{"-u", "root"}
+	if *modDistro != "" {
+		args = append(args, "-d", *modDistro)
+	}
+	args = append(args, "-e", "tar", "-xzf", "-", "-C", "/")
+	exe, err := exec.LookPath(wslExecutable)
+	if err != nil {
+		return fmt.Errorf("unable to extract modules, %s not found (use -modules-root instead)", wslExecutable)
+	}
+	info("extracting kernel modules inside WSL")
+	cmd := exec.CommandContext(ctx, exe, args...)
+	cmd.Stdin = f
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to extract modules: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// extract a gzip compressed tarball into the root directory, refusing entries outside it
+func extractTarGz(fn, root string) error {
+	f, err := os.Open(fn)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return fmt.Errorf("invalid modules tarball %s: %w", fn, err)
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("invalid modules tarball %s: %w", fn, err)
+		}
+
+		target := filepath.Join(root, filepath.FromSlash(hdr.Name))
+		if rel, err := filepath.Rel(root, target); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("modules tarball entry %s is outside of %s", hdr.Name, root)
+		}
+
+		// a symlink extracted earlier must not redirect later entries outside the root
+		last := hdr.Typeflag == tar.TypeSymlink // replaced, rather than followed
+		if err = checkNoSymlinks(root, target, last); err != nil {
+			return fmt.Errorf("modules tarball entry %s: %w", hdr.Name, err)
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(target, 0755)
+		case tar.TypeReg:
+			err = extractFile(tr, target, os.FileMode(hdr.Mode).Perm())
+		case tar.TypeSymlink:
+			os.Remove(target)
+			err = os.Symlink(hdr.Linkname, target)
+		default:
+			verbose("skipping modules tarball entry", hdr.Name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// check the path components of target below root aren't symlinks, except the last one when
+// it is to be replaced. Missing components are fine, since they're created as directories
+func checkNoSymlinks(root, target string, allowLast bool) error {
+	rel, err := filepath.Rel(root, target)
+	if err != nil || rel == "." {
+		return err
+	}
+	parts := strings.Split(rel, string(filepath.Separator))
+	if allowLast {
+		parts = parts[:len(parts)-1]
+	}
+	p := root
+	for _, part := range parts {
+		p = filepath.Join(p, part)
+		fi, err := os.Lstat(p)
+		if os.IsNotExist(err) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("refusing to write through symlink %s", p)
+		}
+	}
+	return nil
+}
+
+// write the reader contents to the named file, creating parent directories as needed
+func extractFile(r io.Reader, fn string, mode os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(fn), 0755); err != nil {
+		return err
+	}
+	out, err := os.OpenFile(fn, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, r)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// write a gzip compressed tarball of the headers, with regular files holding their name
+func writeTarGz(t *testing.T, fn string, hdrs []*tar.Header) {
+	t.Helper()
+	f, err := os.Create(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	for _, hdr := range hdrs {
+		if hdr.Typeflag == tar.TypeReg {
+			hdr.Size = int64(len(hdr.Name))
+		}
+		if err = tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			if _, err = tw.Write([]byte(hdr.Name)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err = tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExtractTarGz(t *testing.T) {
+	dir := tempDir(t)
+	root, outside := filepath.Join(dir, "root"), filepath.Join(dir, "outside")
+	for _, d := range []string{root, outside} {
+		if err := os.Mkdir(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		hdrs    []*tar.Header
+		wantErr string
+	}{
+		{"modules", []*tar.Header{
+			{Name: "lib/modules/5.10/", Typeflag: tar.TypeDir, Mode: 0755},
+			{Name: "lib/modules/5.10/modules.dep", Typeflag: tar.TypeReg, Mode: 0644},
+			{Name: "lib/modules/5.10/build", Typeflag: tar.TypeSymlink, Linkname: "/usr/src/linux"},
+		}, ""},
+		{"parent escape", []*tar.Header{
+			{Name: "../outside/file", Typeflag: tar.TypeReg, Mode: 0644},
+		}, "outside of"},
+		{"write through symlink", []*tar.Header{
+			{Name: "escape", Typeflag: tar.TypeSymlink, Linkname: outside},
+			{Name: "escape/file", Typeflag: tar.TypeReg, Mode: 0644},
+		}, "symlink"},
+		{"mkdir through symlink", []*tar.Header{
+			{Name: "up", Typeflag: tar.TypeSymlink, Linkname: "../outside"},
+			{Name: "up/dir/", Typeflag: tar.TypeDir, Mode: 0755},
+		}, "symlink"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fn := filepath.Join(dir, "modules.tar.gz")
+			writeTarGz(t, fn, tt.hdrs)
+			err := extractTarGz(fn, root)
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("extractTarGz() error = %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("extractTarGz() error = %v, want containing %q", err, tt.wantErr)
+			}
+			if entries, _ := ioutil.ReadDir(outside); len(entries) != 0 {
+				t.Errorf("extractTarGz() wrote %s outside the root", entries[0].Name())
+			}
+		})
+	}
+	if _, err := os.Stat(filepath.Join(root, "lib/modules/5.10/modules.dep")); err != nil {
+		t.Errorf("module file not extracted: %v", err)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/google/go-github/v33/github"
+)
+
+// fields available to -name-template, when naming downloaded images
+type nameData struct {
+	Repository string
+	Tag        string
+	Asset      string // image name in the release
+	SHA        string
+	ShortSHA   string // first 7 hex digits of the SHA
+	Date       string // release publish date, as YYYY-MM-DD
+	Published  time.Time
+}
+
+// returns the naming data of the target's image, with the digest, from the release
+func newNameData(t updateTarget, release *github.RepositoryRelease, digest string) nameData {
+	nd := nameData{
+		Repository: t.repository,
+		Tag:        release.GetTagName(),
+		Asset:      t.imageName,
+		SHA:        digest,
+		ShortSHA:   digest,
+	}
+	if len(nd.ShortSHA) > 7 {
+		nd.ShortSHA = nd.ShortSHA[:7]
+	}
+	if release.PublishedAt != nil {
+		nd.Published = release.PublishedAt.Time
+		nd.Date = nd.Published.Format("2006-01-02")
+	}
+	return nd
+}
+
+// parse an image name template, validating it renders a name for sample data
+func parseNameTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("name").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	sample := nameData{Repository: "owner/repo", Tag: "v1.0", Asset: "bzImage", SHA: emptySHA1, ShortSHA: emptySHA1[:7],
+		Date: "2006-01-02", Published: time.Now()}
+	if _, err = renderName(tmpl, sample); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// render the file name of an image, replacing characters that aren't valid in file names
+func renderName(tmpl *template.Template, nd nameData) (string, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, nd); err != nil {
+		return "", err
+	}
+	name := sanitizeFileName(buf.String())
+	if name == "" {
+		return "", errors.New("image name template rendered an empty file name")
+	}
+	return name, nil
+}
+
+// replace path separators and characters reserved on Windows, and trim the trailing spaces
+// and dots Windows drops from file names
+func sanitizeFileName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '_'
+		}
+		return r
+	}, strings.TrimSpace(name))
+	name = strings.TrimRight(name, " .")
+	if name == "." || name == ".." {
+		return ""
+	}
+	return name
+}
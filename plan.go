@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/google/go-github/v33/github"
+)
+
+// plan of an update, written for review and applied later, once approved
+type plan struct {
+	Repository   string `json:"repository"`
+	Tag          string `json:"tag"`
+	Asset        string `json:"asset"`
+	AssetID      int64  `json:"asset_id"`
+	AssetSize    int    `json:"asset_size"`
+	RemoteDigest string `json:"remote_digest,omitempty"`
+	// PublishedDigest is the <algo>:<hex> digest GitHub publishes for the asset, if any
+	PublishedDigest string `json:"published_digest,omitempty"`
+	LocalKernel     string `json:"local_kernel,omitempty"`
+	LocalDigest     string `json:"local_digest,omitempty"`
+	Destination     string `json:"destination"`
+	Install         bool   `json:"install"`
+	InstallPath     string `json:"install_path,omitempty"`
+}
+
+// resolve the update of the target and write its plan to the named file, without saving
+// anything to disk. The asset's published digest is used when GitHub provides one, otherwise
+// the image is streamed to compute its SHA1 digest
+func writePlan(ctx context.Context, fn string, t updateTarget, local, localSHA string) error {
+	release, asset, err := getReleaseAsset(ctx, t.repository, flagsReleaseQuery(), t.imageName)
+	if err != nil {
+		return err
+	}
+	p := plan{
+		Repository:  t.repository,
+		Tag:         release.GetTagName(),
+		Asset:       asset.GetName(),
+		AssetID:     asset.GetID(),
+		AssetSize:   asset.GetSize(),
+		LocalKernel: local,
+		Install:     *autoInstall,
+		InstallPath: *installPath,
+	}
+	if local != "" {
+		p.LocalDigest = localSHA
+	}
+	if p.PublishedDigest, err = getReleaseAssetDigest(ctx, t.repository, asset); err != nil {
+		verbose("unable to retrieve published asset digest:", err)
+	}
+	if p.PublishedDigest == "" || nameUsesDigest(t, release) {
+		if p.RemoteDigest, err = remoteDigest(ctx, t.repository, asset); err != nil {
+			return err
+		}
+	}
+	if p.Destination, err = imageDestination(t, release, p.RemoteDigest); err != nil {
+		return err
+	}
+	if p.upToDate(local, localSHA) {
+		notice("configured kernel is up to date with release", p.Tag, "--- the plan is a no-op")
+	}
+
+	b, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = ioutil.WriteFile(fn, append(b, '\n'), 0644); err != nil {
+		return err
+	}
+	info("update plan written to", fn)
+	return nil
+}
+
+// apply a previously written update plan, after validating it is still current: the configured
+// kernel and the release asset must not have changed since the plan was written
+func applyPlan(ctx context.Context, fn, local, localSHA string) error {
+	b, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return err
+	}
+	var p plan
+	if err = json.Unmarshal(b, &p); err != nil {
+		return fmt.Errorf("invalid plan %s: %w", fn, err)
+	}
+
+	if local != p.LocalKernel || (local != "" && localSHA != p.LocalDigest) {
+		return errors.New("configured kernel changed since the plan was written")
+	}
+	if p.upToDate(local, localSHA) {
+		info("configured kernel is up to date with release", p.Tag)
+		return nil
+	}
+	if err = checkRepository(p.Repository); err != nil {
+		return err
+	}
+	release, asset, err := getReleaseAsset(ctx, p.Repository, releaseQuery{tag: p.Tag}, p.Asset)
+	if err != nil {
+		return err
+	}
+	if asset.GetID() != p.AssetID {
+		return fmt.Errorf("asset %s of release %s changed since the plan was written", p.Asset, p.Tag)
+	}
+
+	t := updateTarget{repository: p.Repository, imageName: p.Asset, dir: *downloads}
+	copy, digest, _, err := downloadCopyOfReleasedImage(ctx, t, newResolvedAsset(p.Repository, release, asset))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(copy)
+	if p.RemoteDigest != "" && digest != p.RemoteDigest {
+		return fmt.Errorf("downloaded image digest %s doesn't match the planned %s", digest, p.RemoteDigest)
+	}
+	if p.PublishedDigest != "" {
+		if err = verifyDigest(copy, p.PublishedDigest); err != nil {
+			return fmt.Errorf("downloaded image doesn't match the planned digest: %w", err)
+		}
+	}
+
+	*autoInstall, *installPath = p.Install, p.InstallPath
+	if installing() {
+		if err = checkWSL2(ctx); err != nil {
+			return err
+		}
+	}
+	notice("applying plan, copying release", release.GetTagName(), "kernel to", p.Destination)
+	if err = placeKernel(ctx, copy, p.Destination, local, *downloads); errors.Is(err, errKernelChangeDeclined) {
+		info("kernel change declined, nothing was changed")
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if err = writeImageMeta(p.Destination, newImageMeta(p.Repository, release, asset, digest)); err != nil {
+		warn("failed to record image metadata:", err)
+	}
+	if err = archiveRelease(p.Destination, newReleaseArchive(p.Repository, release, asset, digest)); err != nil {
+		return err
+	}
+	if err = audit(auditEntry{
+		Repository:  p.Repository,
+		Tag:         p.Tag,
+		Digest:      digest,
+		Destination: p.Destination,
+		Installed:   installing(),
+		Previous:    local,
+	}); err != nil {
+		return err
+	}
+	if installing() {
+		return postInstall(ctx, installedKernel(p.Destination), p.Tag)
+	}
+	return nil
+}
+
+// checks if the configured kernel is the planned image, by its SHA1 digest when the plan
+// recorded one, or else by the published digest
+func (p plan) upToDate(local, localSHA string) bool {
+	if p.RemoteDigest != "" {
+		return p.RemoteDigest == localSHA
+	}
+	return local != "" && verifyDigest(local, p.PublishedDigest) == nil
+}
+
+// checks if the image name template renders the image digest, in which case the destination
+// can't be named without it
+func nameUsesDigest(t updateTarget, release *github.RepositoryRelease) bool {
+	if *outPath != "" || nameTmpl == nil {
+		return false
+	}
+	a, errA := renderName(nameTmpl, newNameData(t, release, "0000000000"))
+	b, errB := renderName(nameTmpl, newNameData(t, release, "1111111111"))
+	return errA != nil || errB != nil || a != b
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"testing"
+)
+
+func TestWritePlanPublishedDigest(t *testing.T) {
+	tests := []struct {
+		name      string
+		published bool
+		downloads int
+	}{
+		{"published digest", true, 0},
+		{"no published digest", false, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := tempDir(t)
+			release := testRelease(t, dir, "v1", "bzImage")
+			data, err := ioutil.ReadFile(release.Assets[0].Path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			published := fmt.Sprintf("sha256:%x", sha256.Sum256(data))
+			if tt.published {
+				release.Assets[0].Digest = published
+			}
+			ft := newTestFixture(t, release)
+			downloads := 0
+			useTransport(t, roundTripFunc(func(req *http.Request) (*http.Response, error) {
+				if req.Header.Get("Accept") == "application/octet-stream" {
+					downloads++
+				}
+				return ft.RoundTrip(req)
+			}))
+
+			fn := path.Join(dir, "plan.json")
+			target := updateTarget{repository: "owner/repo", imageName: "bzImage", dir: dir}
+			if err = writePlan(context.Background(), fn, target, "", ""); err != nil {
+				t.Fatal(err)
+			}
+			if downloads != tt.downloads {
+				t.Errorf("asset downloaded %d times, want %d", downloads, tt.downloads)
+			}
+
+			b, err := ioutil.ReadFile(fn)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var p plan
+			if err = json.Unmarshal(b, &p); err != nil {
+				t.Fatal(err)
+			}
+			if tt.published {
+				if p.PublishedDigest != published || p.RemoteDigest != "" {
+					t.Errorf("plan digests %q, %q, want only the published %q", p.PublishedDigest, p.RemoteDigest, published)
+				}
+			} else if sha := fmt.Sprintf("%x", sha1.Sum(data)); p.PublishedDigest != "" || p.RemoteDigest != sha {
+				t.Errorf("plan digests %q, %q, want only the remote %q", p.PublishedDigest, p.RemoteDigest, sha)
+			}
+		})
+	}
+}
+
+func TestPlanUpToDate(t *testing.T) {
+	dir := tempDir(t)
+	writeFiles(t, dir, "bzImage")
+	local := path.Join(dir, "bzImage")
+	sha := fmt.Sprintf("%x", sha1.Sum([]byte("bzImage")))
+	published := fmt.Sprintf("sha256:%x", sha256.Sum256([]byte("bzImage")))
+
+	tests := []struct {
+		name            string
+		p               plan
+		local, localSHA string
+		want            bool
+	}{
+		{"remote digest matches", plan{RemoteDigest: sha}, local, sha, true},
+		{"remote digest differs", plan{RemoteDigest: "other"}, local, sha, false},
+		{"published digest matches", plan{PublishedDigest: published}, local, sha, true},
+		{"published digest differs", plan{PublishedDigest: "sha256:00"}, local, sha, false},
+		{"published digest, no local kernel", plan{PublishedDigest: published}, "", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.p.upToDate(tt.local, tt.localSHA); got != tt.want {
+				t.Errorf("upToDate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// kernel image files found in the download directory, split by what pruning would do
+type pruneSet struct {
+	keep   []string
+	remove []string
+}
+
+// select the kernel images in dir to prune, keeping the newest keep images as well as
+// the protected ones (e.g., the configured and previous kernels), which don't count
+// toward the keep limit
+func selectPrunable(dir, imageName string, keep int, protected ...string) (pruneSet, error) {
+	var ps pruneSet
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return ps, err
+	}
+	sort.Slice(entries, func(i, j int) bool { // newest first
+		return entries[i].ModTime().After(entries[j].ModTime())
+	})
+
+	kept := 0
+	for _, fi := range imageFiles(entries, imageName) {
+		fn := path.Join(dir, fi.Name())
+		if isProtected(fn, protected) {
+			ps.keep = append(ps.keep, fn)
+		} else if kept < keep {
+			ps.keep = append(ps.keep, fn)
+			kept++
+		} else {
+			ps.remove = append(ps.remove, fn)
+		}
+	}
+	return ps, nil
+}
+
+// returns the regular files that are kernel images: named after the image, or with the
+// metadata sidecar recorded on download (e.g., images named with -name-template)
+func imageFiles(entries []os.FileInfo, imageName string) []os.FileInfo {
+	sidecars := make(map[string]bool)
+	for _, fi := range entries {
+		if strings.HasSuffix(fi.Name(), metaSuffix) {
+			sidecars[strings.TrimSuffix(fi.Name(), metaSuffix)] = true
+		}
+	}
+	var images []os.FileInfo
+	for _, fi := range entries {
+		name := fi.Name()
+		if fi.Mode().IsRegular() && (isImageFile(name, imageName) || sidecars[name]) {
+			images = append(images, fi)
+		}
+	}
+	return images
+}
+
+// returns true if the file name is that of a (possibly tagged) kernel image, rather than
+// its metadata sidecar
+func isImageFile(name, imageName string) bool {
+	if strings.HasSuffix(name, metaSuffix) || strings.HasSuffix(name, archiveSuffix) {
+		return false
+	}
+	return name == imageName || strings.HasPrefix(name, imageName+".")
+}
+
+// returns true if the file is one of the protected files. Protected paths may be read back
+// from .wslconfig in its Windows format, so both sides are compared as configuration values
+func isProtected(fn string, protected []string) bool {
+	for _, p := range protected {
+		if p != "" && configValue(p) == configValue(fn) {
+			return true
+		}
+	}
+	return false
+}
+
+// remove the prunable kernel images
+func prune(ps pruneSet) error {
+	for _, fn := range ps.remove {
+		info("pruning", fn)
+		if err := os.Remove(fn); err != nil {
+			return err
+		}
+		for _, suffix := range []string{metaSuffix, archiveSuffix} {
+			if err := os.Remove(fn + suffix); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// remove all kernel images in dir, except the configured one and the one kept for
+// -rollback, after confirmation
+func cleanImages(dir, imageName, local string) error {
+	previous, err := previousKernel(dir)
+	if err != nil {
+		return err
+	}
+	ps, err := selectPrunable(dir, imageName, 0, local, previous)
+	if err != nil {
+		return err
+	}
+	if len(ps.remove) == 0 {
+		info("no kernel images to remove in", dir)
+		return nil
+	}
+
+	var total int64
+	for _, fn := range ps.remove {
+		if fi, err := os.Stat(fn); err == nil {
+			total += fi.Size()
+		}
+		info("remove", fn)
+	}
+	ok, err := confirm(fmt.Sprintf("remove %d kernel images (%d bytes)?", len(ps.remove), total))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		notice("nothing removed")
+		return nil
+	}
+	if err = prune(ps); err != nil {
+		return err
+	}
+	notice(fmt.Sprintf("removed %d kernel images, reclaimed %d bytes", len(ps.remove), total))
+	return nil
+}
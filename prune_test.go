@@ -0,0 +1,89 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestCleanImagesKeepsPrevious(t *testing.T) {
+	setBool(t, assumeYes, true)
+	setBool(t, quiet, true)
+	dir := tempDir(t)
+	writeFiles(t, dir, "bzImage.1", "bzImage.2", "bzImage.3", "bzImage.3"+metaSuffix)
+	local, previous := path.Join(dir, "bzImage.3"), path.Join(dir, "bzImage.2")
+	if err := recordPreviousKernel(dir, previous); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cleanImages(dir, "bzImage", local); err != nil {
+		t.Fatalf("cleanImages() error = %v", err)
+	}
+	for fn, kept := range map[string]bool{
+		local:                       true,
+		local + metaSuffix:          true,
+		previous:                    true,
+		path.Join(dir, "bzImage.1"): false,
+	} {
+		if _, err := os.Stat(fn); (err == nil) != kept {
+			t.Errorf("%s kept = %t, want %t", fn, err == nil, kept)
+		}
+	}
+}
+
+func TestSelectPrunableTemplateNames(t *testing.T) {
+	dir := tempDir(t)
+	// images named with -name-template are recognized by their metadata sidecar
+	writeFiles(t, dir, "bzImage.1", "kernel-5.10-abc1234", "kernel-5.10-abc1234"+metaSuffix,
+		"kernel-5.4-def5678", "kernel-5.4-def5678"+metaSuffix, "notes.txt")
+
+	ps, err := selectPrunable(dir, "bzImage", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]bool)
+	for _, fn := range ps.remove {
+		got[path.Base(fn)] = true
+	}
+	want := []string{"bzImage.1", "kernel-5.10-abc1234", "kernel-5.4-def5678"}
+	if len(got) != len(want) {
+		t.Errorf("selectPrunable() removes %v, want %v", ps.remove, want)
+	}
+	for _, name := range want {
+		if !got[name] {
+			t.Errorf("selectPrunable() doesn't remove %s", name)
+		}
+	}
+}
+
+func TestPrunableImagesWindowsHost(t *testing.T) {
+	setInt(t, keepImages, 1)
+	old := windowsHost
+	windowsHost = true
+	t.Cleanup(func() { windowsHost = old })
+	dir := tempDir(t)
+	writeFiles(t, dir, "bzImage.1", "bzImage.2", "bzImage.3", "bzImage.4")
+	// both kernels are read back from their Windows format, e.g., C:\\Users\\me\\bzImage.2
+	local, previous := windowsPath(path.Join(dir, "bzImage.2")), windowsPath(path.Join(dir, "bzImage.1"))
+	if err := ioutil.WriteFile(path.Join(dir, previousKernelFile), []byte(previous+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ps, err := prunableImages(updateTarget{imageName: "bzImage", dir: dir}, local)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kept := make(map[string]bool)
+	for _, fn := range ps.keep {
+		kept[path.Base(fn)] = true
+	}
+	for _, name := range []string{"bzImage.1", "bzImage.2"} {
+		if !kept[name] {
+			t.Errorf("prunableImages() doesn't keep %s, keeps %v", name, ps.keep)
+		}
+	}
+	if len(ps.remove) != 1 {
+		t.Errorf("prunableImages() removes %v, want one image", ps.remove)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parse a transfer rate in bytes per second, optionally with a K, M or G (binary) suffix
+func parseByteRate(value string) (int64, error) {
+	v := strings.ToUpper(strings.TrimSuffix(strings.TrimSpace(value), "/s"))
+	multiplier := int64(1)
+	for i, suffix := range []string{"K", "M", "G"} {
+		if strings.HasSuffix(v, suffix) {
+			v = strings.TrimSuffix(v, suffix)
+			multiplier = 1 << (10 * uint(i+1))
+			break
+		}
+	}
+	rate, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || rate <= 0 {
+		return 0, fmt.Errorf("invalid -rate-limit %s, should be a positive number of bytes per second (e.g., 512K)", value)
+	}
+	return rate * multiplier, nil
+}
+
+// throttledReader limits the average rate of reading from the underlying reader
+type throttledReader struct {
+	ctx   context.Context
+	r     io.Reader
+	rate  int64 // bytes per second
+	start time.Time
+	n     int64
+}
+
+func newThrottledReader(ctx context.Context, r io.Reader, rate int64) *throttledReader {
+	return &throttledReader{ctx: ctx, r: r, rate: rate, start: time.Now()}
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	if int64(len(p)) > t.rate { // read at most a second's worth at a time
+		p = p[:t.rate]
+	}
+	n, err := t.r.Read(p)
+	t.n += int64(n)
+
+	// wait until the bytes read so far are within the rate
+	due := t.start.Add(time.Duration(float64(t.n) / float64(t.rate) * float64(time.Second)))
+	if wait := time.Until(due); wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-t.ctx.Done():
+			return n, t.ctx.Err()
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"text/template"
+)
+
+// read the update targets listed in a repository file. Each line holds a repository and an
+// optional image name (defaulting to -image-name), while empty and '#' comment lines are
+// ignored. Every target is downloaded into a repository named subdirectory of dir
+func readRepoFile(fn, dir string) ([]updateTarget, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var targets []updateTarget
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if len(fields) > 2 {
+			return nil, fmt.Errorf("%s:%d: unexpected format, should be <user>/<repo> [image-name]", fn, line)
+		}
+		if _, _, err = ghOwnerAndRepo(fields[0]); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", fn, line, err)
+		}
+		if err = checkRepository(fields[0]); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", fn, line, err)
+		}
+		t := updateTarget{repository: fields[0], imageName: *imageName, dir: path.Join(dir, fields[0])}
+		if len(fields) == 2 {
+			t.imageName = fields[1]
+		}
+		targets = append(targets, t)
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("no repositories listed in %s", fn)
+	}
+	return targets, nil
+}
+
+// result of checking a repository listed in a repository file
+type repoResult struct {
+	target  updateTarget
+	summary *runSummary
+	err     error
+}
+
+// returned when some, but not all, of the listed repositories failed
+type partialFailureError struct {
+	failed, total int
+}
+
+func (e *partialFailureError) Error() string {
+	return fmt.Sprintf("%d of %d repositories failed", e.failed, e.total)
+}
+
+// check and download updates for each repository listed in the file, concurrently using at
+// most -parallel workers, then print a table of the results (or the summary of each, when
+// using the template or json output). Returns an error if any of the repositories failed,
+// a *partialFailureError if others succeeded
+func updateRepositories(ctx context.Context, fn string, tmpl *template.Template) error {
+	if *autoInstall || *outPath != "" {
+		return errors.New("-install and -o can't be used with -repo-file")
+	}
+	targets, err := readRepoFile(fn, *downloads)
+	if err != nil {
+		return err
+	}
+
+	results := checkRepositories(ctx, targets, *parallel)
+	failed, updated := 0, false
+	for _, r := range results {
+		if r.err != nil {
+			failed++
+		}
+		updated = updated || r.summary.Updated
+	}
+	if !*quiet || updated || failed > 0 {
+		if err = printRepoResults(results, tmpl); err != nil {
+			return err
+		}
+	}
+
+	info(len(targets)-failed, "of", len(targets), "repositories checked successfully")
+	switch {
+	case failed == len(targets):
+		return fmt.Errorf("all %d repositories failed", failed)
+	case failed > 0:
+		return &partialFailureError{failed: failed, total: len(targets)}
+	}
+	return nil
+}
+
+// check the targets concurrently, using at most parallel workers. Results are returned in
+// the same order as the targets. The GitHub client, and the ETag cache and app token shared
+// through its transport, are safe for concurrent use
+func checkRepositories(ctx context.Context, targets []updateTarget, parallel int) []repoResult {
+	if parallel < 1 {
+		parallel = 1
+	}
+	results := make([]repoResult, len(targets))
+	sem := make(chan struct{}, parallel)
+	var wg sync.WaitGroup
+
+	for i, t := range targets {
+		wg.Add(1)
+		go func(i int, t updateTarget) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			info("checking repository", t.repository)
+			r := repoResult{target: t, summary: newRunSummary()}
+			if r.err = os.MkdirAll(t.dir, 0755); r.err == nil {
+				r.err = updateKernel(ctx, t, "", emptySHA1, r.summary)
+			}
+			if r.err != nil {
+				notice("repository", t.repository, "failed:", r.err)
+			}
+			results[i] = r
+		}(i, t)
+	}
+	wg.Wait()
+	return results
+}
+
+// print a table of the repository results, or the summary of each successful repository
+// when using the template or json output
+func printRepoResults(results []repoResult, tmpl *template.Template) error {
+	if tmpl != nil || *output != "text" {
+		for _, r := range results {
+			if r.err != nil {
+				continue
+			}
+			if err := r.summary.print(*output, tmpl); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "REPOSITORY\tSTATUS\tTAG\tDETAILS")
+	for _, r := range results {
+		status, details := "up to date", ""
+		switch {
+		case r.err != nil:
+			status, details = "failed", r.err.Error()
+		case r.summary.Updated:
+			status, details = "updated", r.summary.Destination
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", r.target.repository, status, r.summary.Tag, details)
+	}
+	return w.Flush()
+}
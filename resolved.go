@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/google/go-github/v33/github"
+)
+
+// ResolvedAsset is the image asset of a release, as selected by the resolver, along with
+// the metadata about it used when downloading and reporting
+type ResolvedAsset struct {
+	Repository  string
+	Release     *github.RepositoryRelease
+	Asset       *github.ReleaseAsset
+	Tag         string
+	ID          int64
+	Name        string
+	Size        int
+	ContentType string
+	Published   time.Time // zero if not published
+	DownloadURL string
+}
+
+// resolve the image asset of the release matching the query
+func resolveAsset(ctx context.Context, repository string, query releaseQuery, filename string) (*ResolvedAsset, error) {
+	release, asset, err := getReleaseAsset(ctx, repository, query, filename)
+	if err != nil {
+		return nil, err
+	}
+	return newResolvedAsset(repository, release, asset), nil
+}
+
+func newResolvedAsset(repository string, release *github.RepositoryRelease, asset *github.ReleaseAsset) *ResolvedAsset {
+	ra := &ResolvedAsset{
+		Repository:  repository,
+		Release:     release,
+		Asset:       asset,
+		Tag:         release.GetTagName(),
+		ID:          asset.GetID(),
+		Name:        asset.GetName(),
+		Size:        asset.GetSize(),
+		ContentType: asset.GetContentType(),
+		DownloadURL: asset.GetBrowserDownloadURL(),
+	}
+	if release.PublishedAt != nil {
+		ra.Published = release.PublishedAt.Time
+	}
+	return ra
+}
+
+// Open returns a reader of the asset contents. Each call starts a new download
+func (ra *ResolvedAsset) Open(ctx context.Context) (io.ReadCloser, error) {
+	return downloadReleaseAsset(ctx, ra.Repository, ra.Asset)
+}
+
+// Refresh refetches the asset metadata (e.g., an expired download URL) by its ID
+func (ra *ResolvedAsset) Refresh(ctx context.Context) error {
+	asset, err := getReleaseAssetByID(ctx, ra.Repository, ra.ID)
+	if err != nil {
+		return err
+	}
+	*ra = *newResolvedAsset(ra.Repository, ra.Release, asset)
+	return nil
+}
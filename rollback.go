@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+)
+
+// file, in the download directory, recording the kernel configured before the last install
+const previousKernelFile = ".previous-kernel"
+
+// record the currently configured kernel before installing a new one, so it can be
+// restored by a later rollback. Nothing is recorded when no kernel is configured or its file
+// no longer exists, since there is nothing to roll back to, and the install goes ahead
+func recordPreviousKernel(dir, kernel string) error {
+	if kernel == "" {
+		notice("no kernel currently configured, not keeping a previous kernel")
+		return nil
+	}
+	if _, err := os.Stat(kernel); err != nil {
+		notice("not keeping the configured kernel as the previous kernel:", err)
+		return nil
+	}
+	if err := ioutil.WriteFile(path.Join(dir, previousKernelFile), []byte(kernel+"\n"), 0644); err != nil {
+		return err
+	}
+	info("keeping previous kernel", kernel)
+	return nil
+}
+
+// returns the recorded previous kernel path, or an empty string if none is recorded
+func previousKernel(dir string) (string, error) {
+	b, err := ioutil.ReadFile(path.Join(dir, previousKernelFile))
+	if os.IsNotExist(err) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// restore the configuration to the recorded previous kernel, confirming it still exists
+func rollbackKernel(dir string) (string, error) {
+	kernel, err := previousKernel(dir)
+	if err != nil {
+		return "", err
+	}
+	if kernel == "" {
+		return "", fmt.Errorf("no previous kernel recorded in %s", dir)
+	}
+	if _, err = os.Stat(kernel); err != nil {
+		return "", fmt.Errorf("previous kernel is gone: %w", err)
+	}
+	return kernel, wslConfigSetKernel(kernel)
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"os"
+	"path"
+	"testing"
+)
+
+func TestRecordPreviousKernel(t *testing.T) {
+	setBool(t, quiet, true)
+	dir := tempDir(t)
+	writeFiles(t, dir, "bzImage.1")
+	tests := []struct {
+		name   string
+		kernel string
+		want   string
+	}{
+		{"no configured kernel", "", ""},
+		{"missing configured kernel", path.Join(dir, "bzImage.0"), ""},
+		{"configured kernel", path.Join(dir, "bzImage.1"), path.Join(dir, "bzImage.1")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Remove(path.Join(dir, previousKernelFile))
+			if err := recordPreviousKernel(dir, tt.kernel); err != nil {
+				t.Fatalf("recordPreviousKernel() error = %v", err)
+			}
+			got, err := previousKernel(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("previousKernel() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+// rotatingFile is an io.Writer appending to a file, which is rotated once it reaches its
+// maximal size. Rotated files are renamed with a numeric suffix ('.1' being the newest),
+// keeping at most the configured number of backups
+type rotatingFile struct {
+	name    string
+	maxSize int64 // rotation size in bytes, never rotated if not positive
+	backups int
+
+	mu   sync.Mutex
+	f    *os.File
+	size int64
+}
+
+// open the named file for appending, creating it if needed
+func openRotatingFile(name string, maxSize int64, backups int) (*rotatingFile, error) {
+	rf := &rotatingFile{name: name, maxSize: maxSize, backups: backups}
+	if err := rf.open(); err != nil {
+		return nil, err
+	}
+	return rf, nil
+}
+
+func (rf *rotatingFile) open() error {
+	f, err := os.OpenFile(rf.name, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	rf.f, rf.size = f, fi.Size()
+	return nil
+}
+
+func (rf *rotatingFile) Write(p []byte) (int, error) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	if rf.maxSize > 0 && rf.size > 0 && rf.size+int64(len(p)) > rf.maxSize {
+		if err := rf.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := rf.f.Write(p)
+	rf.size += int64(n)
+	return n, err
+}
+
+// shift the backups, dropping the oldest, and start a new file
+func (rf *rotatingFile) rotate() error {
+	rf.f.Close()
+	if rf.backups > 0 {
+		os.Remove(fmt.Sprintf("%s.%d", rf.name, rf.backups))
+		for i := rf.backups - 1; i > 0; i-- {
+			os.Rename(fmt.Sprintf("%s.%d", rf.name, i), fmt.Sprintf("%s.%d", rf.name, i+1))
+		}
+		if err := os.Rename(rf.name, rf.name+".1"); err != nil {
+			return err
+		}
+	} else if err := os.Remove(rf.name); err != nil {
+		return err
+	}
+	return rf.open()
+}
+
+func (rf *rotatingFile) Close() error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	return rf.f.Close()
+}
@@ -1,10 +1,22 @@
 package main
 
 import (
+	"bytes"
 	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
 	"fmt"
+	"hash"
 	"io"
+	"io/ioutil"
 	"os"
+	"strings"
+)
+
+const (
+	sha1Algorithm   = "sha1"
+	sha256Algorithm = "sha256"
+	sha512Algorithm = "sha512"
 )
 
 var (
@@ -13,20 +25,95 @@ var (
 
 // return the SHA1 digest for the named file
 func sha1sum(fn string) (string, error) {
-	if _, err := os.Stat(fn); err != nil {
-		return emptySHA1, fmt.Errorf("failed to stat %s: %w", fn, err)
+	digest, err := fileDigest(fn, sha1.New())
+	if err != nil {
+		return emptySHA1, err
 	}
+	return digest, nil
+}
+
+// return the hash function for the named digest algorithm
+func newHash(algorithm string) (hash.Hash, error) {
+	switch algorithm {
+	case sha1Algorithm:
+		return sha1.New(), nil
+	case sha256Algorithm:
+		return sha256.New(), nil
+	case sha512Algorithm:
+		return sha512.New(), nil
+	}
+	return nil, fmt.Errorf("unsupported digest algorithm %s", algorithm)
+}
 
+// return the hex encoded digest of the named file, using the given hash function
+func fileDigest(fn string, h hash.Hash) (string, error) {
+	// open without a prior stat, so the file can't change between checking and opening it
 	file, err := os.Open(fn)
-	if err != nil {
-		return emptySHA1, fmt.Errorf("failed to open %s: %w", fn, err)
+	switch {
+	case os.IsNotExist(err):
+		return "", fmt.Errorf("%s does not exist: %w", fn, err)
+	case os.IsPermission(err):
+		return "", fmt.Errorf("%s is not readable: %w", fn, err)
+	case err != nil:
+		return "", fmt.Errorf("failed to open %s: %w", fn, err)
 	}
 	defer file.Close()
 
-	h := sha1.New()
-	_, err = io.Copy(h, file)
+	digest, _, err := readerDigest(file, h)
 	if err != nil {
-		return emptySHA1, fmt.Errorf("failed to checksum %s: %w", fn, err)
+		return "", fmt.Errorf("failed to checksum %s: %w", fn, err)
+	}
+	return digest, nil
+}
+
+// return the hex encoded digest of the reader contents and the number of bytes read
+func readerDigest(r io.Reader, h hash.Hash) (string, int64, error) {
+	n, err := io.Copy(h, r)
+	if err != nil {
+		return "", n, err
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), n, nil
+}
+
+// verify the named file against an '<algo>:<hex>' formatted digest
+func verifyDigest(fn, expected string) error {
+	return verifyDigestWith(fn, expected, func(h hash.Hash) (string, error) { return fileDigest(fn, h) })
+}
+
+// verify the in memory data has the expected digest, formatted as <algo>:<hex>
+func verifyDataDigest(name string, data []byte, expected string) error {
+	return verifyDigestWith(name, expected, func(h hash.Hash) (string, error) {
+		digest, _, err := readerDigest(bytes.NewReader(data), h)
+		return digest, err
+	})
+}
+
+// verify the expected <algo>:<hex> digest of the named content, computed by the function
+func verifyDigestWith(name, expected string, digestOf func(hash.Hash) (string, error)) error {
+	parts := strings.SplitN(expected, ":", 2)
+	if len(parts) != 2 {
+		return fmt.Errorf("unexpected digest format %s, should be <algo>:<hex>", expected)
+	}
+	h, err := newHash(parts[0])
+	if err != nil {
+		return err
+	}
+	digest, err := digestOf(h)
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(digest, parts[1]) {
+		return fmt.Errorf("%s digest mismatch for %s: expected %s, got %s", parts[0], name, parts[1], digest)
+	}
+	return nil
+}
+
+// write the digest of a released image to the named file, using the '<algo>:<hex>  <filename>'
+// checksum line format, preceded by a comment recording the release tag
+func writeDigestFile(fn, digest, tag, filename string) error {
+	content := fmt.Sprintf("# release %s\n%s:%s  %s\n", tag, sha1Algorithm, digest, filename)
+	if err := ioutil.WriteFile(fn, []byte(content), 0644); err != nil {
+		return fmt.Errorf("failed to write digest file %s: %w", fn, err)
 	}
-	return fmt.Sprintf("%x", h.Sum(nil)), nil
+	return nil
 }
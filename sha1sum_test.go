@@ -0,0 +1,41 @@
+package main
+
+import (
+	"crypto/sha1"
+	"errors"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestFileDigestErrors(t *testing.T) {
+	dir := tempDir(t)
+	writeFiles(t, dir, "unreadable")
+	unreadable := path.Join(dir, "unreadable")
+	if err := os.Chmod(unreadable, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("missing file", func(t *testing.T) {
+		_, err := fileDigest(path.Join(dir, "missing"), sha1.New())
+		if !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("fileDigest() error = %v, want os.ErrNotExist", err)
+		}
+	})
+	t.Run("unreadable file", func(t *testing.T) {
+		if os.Geteuid() == 0 {
+			t.Skip("file permissions don't apply to root")
+		}
+		_, err := fileDigest(unreadable, sha1.New())
+		if err == nil || !strings.Contains(err.Error(), "is not readable") {
+			t.Errorf("fileDigest() error = %v, want a not readable error", err)
+		}
+	})
+	t.Run("directory", func(t *testing.T) {
+		_, err := fileDigest(dir, sha1.New())
+		if err == nil || !strings.Contains(err.Error(), "failed to checksum") {
+			t.Errorf("fileDigest() error = %v, want a failed to checksum error", err)
+		}
+	})
+}
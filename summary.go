@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/template"
+	"time"
+)
+
+// summary of a single run, printed once the run completes
+type runSummary struct {
+	Updated     bool          `json:"updated"`
+	Bytes       int64         `json:"bytes_downloaded"`
+	Duration    time.Duration `json:"duration_ns"`
+	Tag         string        `json:"remote_tag,omitempty"`
+	Asset       string        `json:"asset,omitempty"`
+	Destination string        `json:"destination,omitempty"`
+	Digest      string        `json:"digest,omitempty"`
+
+	start     time.Time
+	size      int
+	published time.Time
+}
+
+func newRunSummary() *runSummary {
+	return &runSummary{start: time.Now()}
+}
+
+// print the summary in the requested output format ("text" or "json"), or using the
+// template, if not nil
+func (rs *runSummary) print(format string, tmpl *template.Template) error {
+	rs.Duration = time.Since(rs.start)
+
+	if tmpl != nil {
+		return printFormat(tmpl, formatData{
+			Tag:         rs.Tag,
+			Asset:       rs.Asset,
+			SHA:         rs.Digest,
+			Size:        rs.size,
+			Published:   rs.published,
+			Destination: rs.Destination,
+			Updated:     rs.Updated,
+		})
+	}
+
+	switch format {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(rs)
+	case "text", "":
+		fmt.Println("summary:")
+		fmt.Println("  updated:    ", rs.Updated)
+		fmt.Println("  downloaded: ", rs.Bytes, "bytes")
+		fmt.Println("  duration:   ", rs.Duration.Round(time.Millisecond))
+		fmt.Println("  remote tag: ", rs.Tag)
+		fmt.Println("  asset:      ", rs.Asset)
+		fmt.Println("  destination:", rs.Destination)
+		fmt.Println("  digest:     ", rs.Digest)
+		return nil
+	}
+	return fmt.Errorf("unsupported output format %s, should be text or json", format)
+}
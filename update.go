@@ -0,0 +1,360 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v33/github"
+)
+
+// an update target: the repository and image name to download and the directory to
+// download into
+type updateTarget struct {
+	repository string
+	imageName  string
+	dir        string
+}
+
+// check the target repository for a kernel image differing from the local one, download it
+// and, if requested, install it. Progress is recorded in the summary
+func updateKernel(ctx context.Context, t updateTarget, local, localSHA string, summary *runSummary) error {
+	ra, err := resolveAsset(ctx, t.repository, flagsReleaseQuery(), t.imageName)
+	if err != nil {
+		return err
+	}
+	release, asset, remoteTag := ra.Release, ra.Asset, ra.Tag
+	summary.Tag, summary.Asset, summary.size, summary.published = remoteTag, ra.Name, ra.Size, ra.Published
+	if skipTags.contains(remoteTag) {
+		info("skipping release tagged", remoteTag)
+		return nil
+	}
+
+	if *minAge > 0 {
+		if ra.Published.IsZero() {
+			notice("release", remoteTag, "has no publish date, skipping it for -min-age", *minAge)
+			return nil
+		}
+		if age := time.Since(ra.Published); age < *minAge {
+			notice("release", remoteTag, "was published", age.Round(time.Minute), "ago, less than -min-age", *minAge,
+				"-- wait another", (*minAge - age).Round(time.Minute))
+			return nil
+		}
+	}
+
+	if err = checkArch(archFromName(ra.Name), "asset "+ra.Name, *force); err != nil {
+		return err
+	}
+
+	// the digest isn't known before downloading, so check the length with a placeholder
+	if destination, err := imageDestination(t, release, emptySHA1); err == nil {
+		checkPathLength(destination)
+	}
+
+	if local != "" && !*alwaysDL { // the sidecar saves downloading an image already in place
+		if m, err := readImageMeta(local); err == nil && m.matches(t.repository, asset, localSHA) {
+			info("local kernel recorded as downloaded from release", remoteTag+", already up to date")
+			return nil
+		}
+	}
+
+	if local != "" {
+		if fi, err := os.Stat(local); err == nil {
+			infof("local kernel size %d bytes, remote %d bytes (delta %+d bytes)\n",
+				fi.Size(), ra.Size, int64(ra.Size)-fi.Size())
+		}
+	}
+
+	info("downloading remote image from", t.repository)
+	copy, remoteSHA, n, err := downloadCopyOfReleasedImage(ctx, t, ra)
+	summary.Bytes, summary.Digest = n, remoteSHA
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if _, err := os.Stat(copy); err == nil && *keepTemp {
+			info("downloaded image kept in", copy)
+		} else {
+			os.Remove(copy) // no-op once the copy is moved into place
+		}
+	}()
+
+	info("remote kernel tagged", remoteTag, "digest:", remoteSHA)
+	arch, err := archFromImage(copy)
+	if err == nil {
+		err = checkArch(arch, "downloaded image", *force)
+	}
+	if err != nil {
+		return err
+	}
+
+	imageVersion, err := imageKernelVersion(copy)
+	if err != nil {
+		return err
+	}
+	if imageVersion != "" {
+		info("image kernel version:", imageVersion)
+	}
+	if *verifyVer {
+		if err = checkImageVersion(imageVersion, remoteTag); err != nil {
+			return err
+		}
+	}
+
+	destination, err := imageDestination(t, release, remoteSHA)
+	if err != nil {
+		return err
+	}
+	info("kernel image file name:", filepath.Base(destination))
+	summary.Destination = destination
+
+	if *digestFile != "" {
+		if err = writeDigestFile(*digestFile, remoteSHA, remoteTag, filepath.Base(destination)); err != nil {
+			return err
+		}
+	}
+
+	if *alwaysDL {
+		if remoteSHA == localSHA {
+			notice("digest matches the local kernel, copying kernel to", destination)
+		} else {
+			notice("digests differ, copying new kernel to", destination)
+		}
+	} else {
+		if remoteSHA == localSHA {
+			info("latest release already in", t.dir)
+			return nil
+		}
+		if !*autoInstall { // an identical image may have been downloaded without being installed
+			if digest, err := sha1sum(destination); err == nil && digest == remoteSHA {
+				info("latest release already downloaded to", destination)
+				return nil
+			}
+		}
+		notice("digests differ, copying new kernel to", destination)
+	}
+	if *installNew && local != "" { // otherwise fall back to installing when digests differ
+		remote, ok := parseKernelVersion(imageVersion)
+		if !ok {
+			remote, ok = parseKernelVersion(remoteTag)
+		}
+		if current, cok := fileKernelVersion(local); ok && cok && remote.compare(current) <= 0 {
+			notice("release", remoteTag, "kernel", remote, "is not newer than the configured", current, "kernel, not installing it")
+			*autoInstall = false
+		}
+	}
+	if err = placeKernel(ctx, copy, destination, local, t.dir); errors.Is(err, errKernelChangeDeclined) {
+		info("kernel change declined, nothing was changed")
+		return nil
+	} else if err != nil {
+		return err
+	}
+	summary.Updated = true
+	if err = writeImageMeta(destination, newImageMeta(t.repository, release, asset, remoteSHA)); err != nil {
+		warn("failed to record image metadata:", err)
+	}
+	if err = archiveRelease(destination, newReleaseArchive(t.repository, release, asset, remoteSHA)); err != nil {
+		return err
+	}
+	if err = audit(auditEntry{
+		Repository:  t.repository,
+		Tag:         remoteTag,
+		Digest:      remoteSHA,
+		Destination: destination,
+		Installed:   installing(),
+		Previous:    local,
+	}); err != nil {
+		return err
+	}
+	if installing() && *modAsset != "" {
+		if err = installModules(ctx, t.repository, release); err != nil {
+			return err
+		}
+	}
+	if len(extraAssets) > 0 {
+		if err = downloadExtraAssets(ctx, t, release); err != nil {
+			return err
+		}
+	}
+	if *keepImages > 0 {
+		if err = pruneImages(t, local, destination); err != nil {
+			return err
+		}
+	}
+	if installing() {
+		return postInstall(ctx, installedKernel(destination), remoteTag)
+	}
+	return nil
+}
+
+// returns the destination path of the target's image with the digest, from the release
+func imageDestination(t updateTarget, release *github.RepositoryRelease, digest string) (string, error) {
+	if *outPath != "" {
+		return *outPath, nil
+	}
+	if nameTmpl != nil {
+		name, err := renderName(nameTmpl, newNameData(t, release, digest))
+		if err != nil {
+			return "", fmt.Errorf("failed to name the image: %w", err)
+		}
+		return path.Join(t.dir, name), nil
+	}
+	destination := path.Join(t.dir, t.imageName)
+	if *tagImage && !*plainName {
+		destination = fmt.Sprintf("%s.%s", destination, release.GetTagName())
+	}
+	return path.Clean(destination), nil
+}
+
+// download a released image, returns the local copy path, SHA1 digest and downloaded byte count.
+// Downloads interrupted while reading the body are retried, from the start, up to -retries times
+func downloadCopyOfReleasedImage(ctx context.Context, t updateTarget, ra *ResolvedAsset) (string, string, int64, error) {
+	out, err := ioutil.TempFile("", t.imageName+".*")
+	if err != nil {
+		return "", "", 0, err
+	}
+	destination := out.Name()
+
+	var n int64
+	for attempt := 1; ; attempt++ {
+		n, err = downloadTo(ctx, ra, out)
+		var re *readError
+		if err == nil || !errors.As(err, &re) || attempt > *retries {
+			break
+		}
+		notice(fmt.Sprintf("download interrupted after %d bytes (%v), retrying (%d of %d)", n, re.err, attempt, *retries))
+		if err = ra.Refresh(ctx); err != nil {
+			break
+		}
+	}
+	out.Close()
+
+	if err != nil {
+		notice("unable to save downloaded image")
+		os.Remove(destination)
+		return "", "", n, err
+	}
+
+	published, err := getReleaseAssetDigest(ctx, t.repository, ra.Asset)
+	if err != nil {
+		info("unable to retrieve published asset digest:", err)
+	} else if published != "" {
+		if err = verifyDigest(destination, published); err != nil {
+			os.Remove(destination)
+			return "", "", n, err
+		}
+		info("verified image against published digest", published)
+	}
+
+	if *checksumURL != "" {
+		expected, err := fetchChecksum(ctx, *checksumURL, ra.Name)
+		if err == nil {
+			err = verifyChecksums(destination, expected, *checksumURL)
+		}
+		if err != nil {
+			os.Remove(destination)
+			return "", "", n, err
+		}
+	}
+	if *checksumAst != "" {
+		expected, err := releaseChecksum(ctx, ra, *checksumAst, ra.Name)
+		if err == nil {
+			err = verifyChecksums(destination, expected, *checksumAst)
+		}
+		if err != nil {
+			os.Remove(destination)
+			return "", "", n, err
+		}
+	}
+
+	digest, err := sha1sum(destination)
+	return destination, digest, n, err
+}
+
+// verify the downloaded image against all the digests listed for it in the checksum source
+func verifyChecksums(fn string, digests []string, source string) error {
+	algorithms, err := verifyDigests(fn, digests)
+	if err != nil {
+		return err
+	}
+	info("verified image", strings.Join(algorithms, ", "), "digests from", source)
+	return nil
+}
+
+// readError wraps errors reading a download body, as opposed to errors connecting or writing
+type readError struct {
+	err error
+}
+
+func (e *readError) Error() string { return e.err.Error() }
+func (e *readError) Unwrap() error { return e.err }
+
+// readErrorReader marks errors returned by the underlying reader as read errors
+type readErrorReader struct {
+	r io.Reader
+}
+
+func (r readErrorReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if err != nil && err != io.EOF {
+		err = &readError{err: err}
+	}
+	return n, err
+}
+
+// download an asset into the file, replacing any previous contents
+func downloadTo(ctx context.Context, ra *ResolvedAsset, out *os.File) (int64, error) {
+	rc, err := ra.Open(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer rc.Close()
+
+	if err = out.Truncate(0); err != nil {
+		return 0, err
+	}
+	if _, err = out.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	var r io.Reader = readErrorReader{r: rc}
+	if byteRate > 0 {
+		r = newThrottledReader(ctx, r, byteRate)
+	}
+	return io.Copy(out, r)
+}
+
+// download the additional requested assets of the release into the target directory
+func downloadExtraAssets(ctx context.Context, t updateTarget, release *github.RepositoryRelease) error {
+	assets := make([]*github.ReleaseAsset, 0, len(extraAssets))
+	for _, name := range extraAssets {
+		ra, err := findReleaseAsset(release, name)
+		if err != nil {
+			return err
+		}
+		assets = append(assets, ra)
+	}
+
+	results, err := downloadAssets(ctx, t.repository, assets, *parallel)
+	for _, r := range results {
+		if r.err != nil {
+			notice("failed to download asset", r.asset.GetName()+":", r.err)
+			continue
+		}
+		destination := path.Join(t.dir, r.asset.GetName())
+		if err == nil {
+			info("copying asset", r.asset.GetName(), "to", destination)
+			if err = os.Rename(r.path, destination); err == nil {
+				continue
+			}
+		}
+		os.Remove(r.path)
+	}
+	return err
+}
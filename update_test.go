@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+)
+
+// failingReader returns the error once n bytes were read
+type failingReader struct {
+	r   io.Reader
+	n   int
+	err error
+}
+
+func (f *failingReader) Read(p []byte) (int, error) {
+	if f.n <= 0 {
+		return 0, f.err
+	}
+	if len(p) > f.n {
+		p = p[:f.n]
+	}
+	n, err := f.r.Read(p)
+	f.n -= n
+	return n, err
+}
+
+func TestDownloadRetries(t *testing.T) {
+	setBool(t, quiet, true)
+	errReset := errors.New("connection reset by peer")
+	tests := []struct {
+		name     string
+		failures int  // number of failing download attempts
+		connect  bool // fail connecting, rather than reading the body
+		attempts int
+		wantErr  bool
+	}{
+		{name: "retry succeeds", failures: 1, attempts: 2},
+		{name: "retries exhausted", failures: 3, attempts: 3, wantErr: true},
+		{name: "connection error not retried", failures: 1, connect: true, attempts: 1, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setInt(t, retries, 2)
+			dir := tempDir(t)
+			release := testRelease(t, dir, "5.10.16", "bzImage")
+			ft := newTestFixture(t, release)
+			attempts := 0
+			useTransport(t, roundTripFunc(func(req *http.Request) (*http.Response, error) {
+				if req.Header.Get("Accept") != "application/octet-stream" {
+					return ft.RoundTrip(req)
+				}
+				attempts++
+				if attempts > tt.failures {
+					return ft.RoundTrip(req)
+				}
+				if tt.connect {
+					return nil, errReset
+				}
+				resp, err := ft.RoundTrip(req)
+				if err == nil { // the body fails part way through
+					resp.Body = ioutil.NopCloser(&failingReader{r: resp.Body, n: 3, err: errReset})
+				}
+				return resp, err
+			}))
+
+			ra, err := resolveAsset(context.Background(), "owner/repo", releaseQuery{}, "bzImage")
+			if err != nil {
+				t.Fatal(err)
+			}
+			copy, digest, _, err := downloadCopyOfReleasedImage(context.Background(),
+				updateTarget{repository: "owner/repo", imageName: "bzImage", dir: dir}, ra)
+			if attempts != tt.attempts {
+				t.Errorf("download attempts = %d, want %d", attempts, tt.attempts)
+			}
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), errReset.Error()) {
+					t.Errorf("downloadCopyOfReleasedImage() error = %v, want %v", err, errReset)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("downloadCopyOfReleasedImage() error = %v", err)
+			}
+			defer os.Remove(copy)
+			if want, _ := sha1sum(release.Assets[0].Path); digest != want {
+				t.Errorf("downloaded digest = %s, want %s", digest, want)
+			}
+		})
+	}
+}
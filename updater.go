@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/google/go-github/v33/github"
+)
+
+// Updater checks a repository's releases for kernel images differing from the configured one
+type Updater struct {
+	Repository string       // GitHub repository, as <user>/<repo>
+	ImageName  string       // kernel image asset name
+	Query      releaseQuery // release selection criteria
+	Kernel     string       // currently configured kernel path, empty if none
+}
+
+// Info describes the configured and remote kernels compared by an Updater
+type Info struct {
+	LocalDigest  string // SHA1 digest of the configured kernel, empty if none is configured
+	RemoteDigest string // SHA1 digest of the remote kernel image
+	RemoteTag    string // tag of the release holding the remote kernel image
+}
+
+// UpdateAvailable reports whether the remote kernel image differs from the configured one.
+// The remote image is hashed as it is streamed, so nothing is written to disk
+func (u *Updater) UpdateAvailable(ctx context.Context) (bool, Info, error) {
+	var status Info
+	if u.Kernel != "" {
+		digest, err := sha1sum(u.Kernel)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return false, status, err
+		} else if err == nil {
+			status.LocalDigest = digest
+		}
+	}
+
+	release, asset, err := getReleaseAsset(ctx, u.Repository, u.Query, u.ImageName)
+	if err != nil {
+		return false, status, err
+	}
+	status.RemoteTag = release.GetTagName()
+	if status.RemoteDigest, err = remoteDigest(ctx, u.Repository, asset); err != nil {
+		return false, status, err
+	}
+	return status.RemoteDigest != status.LocalDigest, status, nil
+}
+
+// returns the SHA1 digest of a release asset, streaming it through the hash function
+func remoteDigest(ctx context.Context, repository string, asset *github.ReleaseAsset) (string, error) {
+	rc, err := downloadReleaseAsset(ctx, repository, asset)
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+
+	digest, _, err := readerDigest(rc, sha1.New())
+	if err != nil {
+		return "", fmt.Errorf("failed to checksum remote image: %w", err)
+	}
+	return digest, nil
+}
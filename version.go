@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+)
+
+// kernel version, as parsed from release tags (e.g., 'v5.10.16-microsoft' or 'wsl2-6.6.1')
+type kernelVersion struct {
+	major, minor, patch int
+}
+
+var kernelVersionRE = regexp.MustCompile(`(\d+)\.(\d+)(?:\.(\d+))?`)
+
+// parse the first version number found in the string
+func parseKernelVersion(s string) (kernelVersion, bool) {
+	m := kernelVersionRE.FindStringSubmatch(s)
+	if m == nil {
+		return kernelVersion{}, false
+	}
+	var v kernelVersion
+	v.major, _ = strconv.Atoi(m[1])
+	v.minor, _ = strconv.Atoi(m[2])
+	if m[3] != "" {
+		v.patch, _ = strconv.Atoi(m[3])
+	}
+	return v, true
+}
+
+// compare versions, returning a negative number when v < other, zero when equal and a
+// positive number when v > other
+func (v kernelVersion) compare(other kernelVersion) int {
+	if v.major != other.major {
+		return v.major - other.major
+	}
+	if v.minor != other.minor {
+		return v.minor - other.minor
+	}
+	return v.patch - other.patch
+}
+
+// describes how v relates to the other version: matches, is older than or is newer than
+func (v kernelVersion) relation(other kernelVersion) string {
+	switch c := v.compare(other); {
+	case c < 0:
+		return "is older than"
+	case c > 0:
+		return "is newer than"
+	}
+	return "matches"
+}
+
+// returns the major.minor kernel line of the version
+func (v kernelVersion) line() string {
+	return fmt.Sprintf("%d.%d", v.major, v.minor)
+}
+
+func (v kernelVersion) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.major, v.minor, v.patch)
+}
+
+// returns the kernel version of an image file, taken from the version string embedded in
+// the image or, failing that, from its recorded release tag or its file name
+func fileKernelVersion(fn string) (kernelVersion, bool) {
+	if s, err := imageKernelVersion(fn); err == nil {
+		if v, ok := parseKernelVersion(s); ok {
+			return v, true
+		}
+	}
+	if m, err := readImageMeta(fn); err == nil {
+		if v, ok := parseKernelVersion(m.Tag); ok {
+			return v, true
+		}
+	}
+	return parseKernelVersion(path.Base(fn))
+}
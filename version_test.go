@@ -0,0 +1,28 @@
+package main
+
+import "testing"
+
+func TestKernelVersionRelation(t *testing.T) {
+	tests := []struct {
+		running, other string
+		want           string
+	}{
+		{"5.10.16.3-microsoft-standard-WSL2", "5.10.16-microsoft", "matches"},
+		{"4.19.128-microsoft-standard", "5.10.16-microsoft", "is older than"},
+		{"5.10.43.3-microsoft-standard-WSL2", "v5.10.16", "is newer than"},
+		{"5.10.16.3-microsoft-standard-WSL2", "5.10", "is newer than"},
+	}
+	for _, tt := range tests {
+		rv, ok := parseKernelVersion(tt.running)
+		if !ok {
+			t.Fatalf("failed to parse %s", tt.running)
+		}
+		ov, ok := parseKernelVersion(tt.other)
+		if !ok {
+			t.Fatalf("failed to parse %s", tt.other)
+		}
+		if got := rv.relation(ov); got != tt.want {
+			t.Errorf("%s.relation(%s) = %q, want %q", tt.running, tt.other, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"unicode/utf16"
+)
+
+// WSL command line executable, available on Windows and, via interop, inside WSL distros
+const wslExecutable = "wsl.exe"
+
+// run a wsl.exe command, returning its trimmed output
+func wslCommand(ctx context.Context, args ...string) (string, error) {
+	exe, err := exec.LookPath(wslExecutable)
+	if err != nil {
+		return "", errors.New("WSL doesn't seem to be installed: " + wslExecutable + " not found")
+	}
+	out, err := exec.CommandContext(ctx, exe, args...).Output()
+	if err != nil {
+		return "", fmt.Errorf("%s %s failed: %w", wslExecutable, strings.Join(args, " "), err)
+	}
+	return strings.TrimSpace(decodeText(out)), nil
+}
+
+// decode text which may be UTF-16LE encoded (as wsl.exe's own messages are), stripping any BOM
+func decodeText(b []byte) string {
+	switch {
+	case bytes.HasPrefix(b, []byte{0xff, 0xfe}):
+		return decodeUTF16LE(b[2:])
+	case len(b) >= 2 && b[1] == 0: // no BOM, but looks like UTF-16LE ASCII text
+		return decodeUTF16LE(b)
+	}
+	return string(bytes.TrimPrefix(b, []byte("\xef\xbb\xbf")))
+}
+
+// decode UTF-16LE bytes, ignoring a trailing odd byte
+func decodeUTF16LE(b []byte) string {
+	u := make([]uint16, len(b)/2)
+	for i := range u {
+		u[i] = binary.LittleEndian.Uint16(b[2*i:])
+	}
+	return string(utf16.Decode(u))
+}
+
+// returns true if any installed WSL distribution runs as WSL2, based on the VERSION column
+// of 'wsl.exe --list --verbose'
+func wslHasVersion2Distro(ctx context.Context) (bool, error) {
+	out, err := wslCommand(ctx, "--list", "--verbose")
+	if err != nil {
+		return false, err
+	}
+	lines := strings.Split(out, "\n")
+	for _, line := range lines[1:] { // skip the header line
+		fields := strings.Fields(line)
+		if len(fields) > 0 && fields[len(fields)-1] == "2" {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// returns the version of the kernel WSL2 is currently running
+func wslRunningKernelVersion(ctx context.Context) (string, error) {
+	return wslCommand(ctx, "-e", "uname", "-r")
+}
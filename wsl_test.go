@@ -0,0 +1,41 @@
+package main
+
+import (
+	"testing"
+	"unicode/utf16"
+)
+
+// encode the text as UTF-16LE, with a BOM if requested
+func utf16LE(s string, bom bool) []byte {
+	var b []byte
+	if bom {
+		b = append(b, 0xff, 0xfe)
+	}
+	for _, u := range utf16.Encode([]rune(s)) {
+		b = append(b, byte(u), byte(u>>8))
+	}
+	return b
+}
+
+func TestDecodeText(t *testing.T) {
+	const config = "[wsl2]\r\nkernel = C:\\\\k\\\\bzImage\r\n"
+	tests := []struct {
+		name string
+		in   []byte
+		want string
+	}{
+		{"utf-8", []byte(config), config},
+		{"utf-8 bom", append([]byte("\xef\xbb\xbf"), config...), config},
+		{"utf-16le bom", utf16LE(config, true), config},
+		{"utf-16le", utf16LE(config, false), config},
+		{"non-ascii utf-16le", utf16LE("[wsl2]\nkernel = C:\\\\Users\\\\Zoë\\\\k", true), "[wsl2]\nkernel = C:\\\\Users\\\\Zoë\\\\k"},
+		{"empty", nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := decodeText(tt.in); got != tt.want {
+				t.Errorf("decodeText() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
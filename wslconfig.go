@@ -1,9 +1,18 @@
 package main
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
 	"os"
 	"os/user"
 	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
 
 	"gopkg.in/ini.v1"
 )
@@ -20,7 +29,11 @@ func wslConfigGetKernelPath() (string, error) {
 	if err != nil {
 		return "", err
 	}
-	return cfg.Section(wsl2Section).Key(wsl2KernelKey).String(), nil
+	kernel := cfg.Section(wsl2Section).Key(wsl2KernelKey).String()
+	if *windowsHome != "" && kernel != "" {
+		kernel = mountedPath(kernel)
+	}
+	return kernel, nil
 }
 
 // sets the configured kernel path, creating the configuration file if needed
@@ -34,12 +47,88 @@ func wslConfigSetKernel(kernel string) error {
 		cfg = ini.Empty() // create an empty configuration
 	}
 
-	ini.PrettyFormat = false // don't align '=' across keys
-	ini.PrettyEqual = true   // but keep spaces around the '=' sign
-	cfg.Section(wsl2Section).Key(wsl2KernelKey).SetValue(kernel)
-	filename, _ := wslConfigFilePath()
-	err = cfg.SaveTo(filename)
-	return err
+	cfg.Section(wsl2Section).Key(wsl2KernelKey).SetValue(configValue(kernel))
+	filename, err := wslConfigFilePath()
+	if err != nil {
+		return err
+	}
+	if *installTo != "" { // the configuration is read from the real file but written elsewhere
+		filename = *installTo
+	}
+	return wslConfigSave(cfg, filename)
+}
+
+// save the configuration to the named file, formatted as 'key = value' without aligning
+// the '=' signs across keys
+func wslConfigSave(cfg *ini.File, filename string) error {
+	var buf bytes.Buffer
+	writeWSLConfig(&buf, cfg)
+
+	if *backupKeep > 0 {
+		if err := backupWSLConfig(filename, *backupKeep); err != nil {
+			return err
+		}
+	}
+	// write a symlinked configuration through the link, so the link itself is preserved
+	if fi, err := os.Lstat(filename); err == nil && fi.Mode()&os.ModeSymlink != 0 {
+		target, err := filepath.EvalSymlinks(filename)
+		if err != nil {
+			return fmt.Errorf("failed to resolve symlinked %s: %w", filename, err)
+		}
+		verbose("writing symlinked", filename, "through to", target)
+		filename = target
+	}
+	return ioutil.WriteFile(filename, buf.Bytes(), 0644)
+}
+
+// write the configuration the way the ini package does with its default options, except
+// that '=' signs aren't aligned across keys. The ini package (as of v1.62) only controls the
+// alignment with its PrettyFormat package variable, with no per file option, so the
+// configuration is written here rather than changing the package's global state
+func writeWSLConfig(buf *bytes.Buffer, cfg *ini.File) {
+	for i, section := range cfg.Sections() {
+		writeINIComment(buf, section.Comment)
+		if i > 0 || section.Name() != ini.DefaultSection {
+			buf.WriteString("[" + section.Name() + "]" + ini.LineBreak)
+		} else if len(section.Keys()) == 0 {
+			continue // the default section is only written when it has keys
+		}
+		for _, key := range section.Keys() {
+			writeINIComment(buf, key.Comment)
+			buf.WriteString(iniQuote(key.Name(), "\"=:", "`") + " = " + iniQuote(key.Value(), "#;", "\n`") + ini.LineBreak)
+		}
+		buf.WriteString(ini.LineBreak) // sections are separated by a blank line
+	}
+}
+
+// write the comment lines, each prefixed with a comment marker
+func writeINIComment(buf *bytes.Buffer, comment string) {
+	if comment == "" {
+		return
+	}
+	for _, line := range strings.Split(comment, ini.LineBreak) {
+		if line != "" && (line[0] == '#' || line[0] == ';') {
+			line = line[:1] + " " + strings.TrimSpace(line[1:])
+		} else {
+			line = "; " + strings.TrimSpace(line)
+		}
+		buf.WriteString(line + ini.LineBreak)
+	}
+}
+
+// quote a key name or value as the ini package reads it back: backticks when it contains any
+// of the quoted characters, triple quotes for any of the multiline characters, and plain
+// quotes to keep leading or trailing spaces
+func iniQuote(s, quoted, multiline string) string {
+	switch {
+	case strings.ContainsAny(s, multiline):
+		return `"""` + s + `"""`
+	case strings.ContainsAny(s, quoted):
+		return "`" + s + "`"
+	case strings.TrimSpace(s) != s:
+		return `"` + s + `"`
+	}
+	return s
 }
 
 // returns the default location of WSL configuration file
@@ -54,11 +143,19 @@ func wslConfigLoad() (*ini.File, error) {
 	if _, err = os.Stat(cfg); os.IsNotExist(err) {
 		return nil, err
 	}
-	return ini.Load(cfg)
+	b, err := ioutil.ReadFile(cfg)
+	if err != nil {
+		return nil, err
+	}
+	// editors such as Notepad may save with a BOM or as UTF-16, saving rewrites it as plain UTF-8
+	return ini.Load([]byte(decodeText(b)))
 }
 
 // returns the (default) WSL configuration file path
 func wslConfigFilePath() (string, error) {
+	if *windowsHome != "" {
+		return path.Join(*windowsHome, wslConfigFile), nil
+	}
 	home, err := userHomeDirectory()
 	if err != nil {
 		return "", err
@@ -66,11 +163,120 @@ func wslConfigFilePath() (string, error) {
 	return path.Join(home, wslConfigFile), nil
 }
 
+// returned when the user home directory can't be determined
+var errNoHomeDirectory = errors.New("failed to determine the user home directory")
+
+// looks up the current user, replaceable in tests
+var currentUser = user.Current
+
 // returns the home directory path of the current user
 func userHomeDirectory() (string, error) {
-	u, err := user.Current()
+	u, err := currentUser()
+	if err == nil && u.HomeDir != "" {
+		return u.HomeDir, nil
+	}
+	// the current user can't always be resolved (e.g., static builds without cgo)
+	for _, env := range []string{"HOME", "USERPROFILE"} {
+		if home := os.Getenv(env); home != "" {
+			return home, nil
+		}
+	}
+	if err == nil {
+		return "", errNoHomeDirectory
+	}
+	return "", fmt.Errorf("%w: %v", errNoHomeDirectory, err)
+}
+
+// true when running on Windows, replaceable in tests
+var windowsHost = runtime.GOOS == "windows"
+
+// returns the kernel path as written to .wslconfig: in the Windows format, with escaped
+// backslashes, when configuring a Windows home or running on Windows
+func configValue(kernel string) string {
+	if *windowsHome != "" || windowsHost {
+		return windowsPath(kernel)
+	}
+	return path.Clean(kernel)
+}
+
+// convert a (possibly mounted, e.g. /mnt/c/...) path to the Windows format expected
+// in .wslconfig, using escaped backslashes as separators
+func windowsPath(p string) string {
+	p = strings.ReplaceAll(p, `\`, "/")
+	if strings.HasPrefix(p, "/mnt/") {
+		parts := strings.SplitN(strings.TrimPrefix(p, "/mnt/"), "/", 2)
+		if len(parts[0]) == 1 {
+			p = strings.ToUpper(parts[0]) + ":/"
+			if len(parts) == 2 {
+				p += parts[1]
+			}
+		}
+	}
+	return strings.ReplaceAll(path.Clean(p), "/", `\\`)
+}
+
+// returns the directory of a configured kernel path. Unlike path.Dir, Windows style paths
+// (e.g., C:\\Users\\me\\bzImage or C:\Users\me\bzImage) are split on their backslash
+// separators, and the separator style of the path is preserved
+func kernelDir(kernel string) string {
+	i := strings.LastIndexAny(kernel, `/\`)
+	if i < 0 {
+		return "."
+	}
+	dir := strings.TrimRight(kernel[:i], `/\`)
+	switch {
+	case dir == "": // file in the root directory
+		return kernel[:1]
+	case len(dir) == 2 && dir[1] == ':': // file in the root of a drive, keep the separator
+		return kernel[:3]
+	case !strings.Contains(kernel, `\`):
+		return path.Clean(dir)
+	}
+	return dir
+}
+
+// convert a Windows formatted path (e.g., C:\\Users\\me) to its mounted equivalent
+// under /mnt, so it can be accessed when not running on Windows
+func mountedPath(p string) string {
+	p = path.Clean(strings.ReplaceAll(p, `\`, "/"))
+	if len(p) >= 2 && p[1] == ':' {
+		p = path.Join("/mnt", strings.ToLower(p[:1]), p[2:])
+	}
+	return p
+}
+
+// time format of configuration backup file name suffixes, sorting chronologically and
+// valid in Windows file names
+const backupTimeFormat = "2006-01-02T15-04-05.000"
+
+// copy the existing configuration file to a timestamped backup next to it, keeping only the
+// most recent backups
+func backupWSLConfig(filename string, keep int) error {
+	if _, err := os.Stat(filename); os.IsNotExist(err) {
+		return nil // nothing to back up
+	}
+	backup := filename + "." + time.Now().UTC().Format(backupTimeFormat)
+	if err := copyFile(filename, backup); err != nil {
+		return fmt.Errorf("failed to back up %s: %w", filename, err)
+	}
+	verbose("backed up", filename, "to", backup)
+
+	matches, err := filepath.Glob(filename + ".*")
 	if err != nil {
-		return "", err
+		return err
+	}
+	var backups []string
+	for _, m := range matches {
+		if _, err := time.Parse(backupTimeFormat, strings.TrimPrefix(m, filename+".")); err == nil {
+			backups = append(backups, m)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(backups))) // newest first
+	for i := keep; i < len(backups); i++ {
+		verbose("removing old backup", backups[i])
+		if err := os.Remove(backups[i]); err != nil {
+			return err
+		}
 	}
-	return u.HomeDir, nil
+	return nil
 }
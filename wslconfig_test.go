@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path"
+	"strings"
+	"testing"
+
+	"gopkg.in/ini.v1"
+)
+
+func TestWSLConfigEncodings(t *testing.T) {
+	const config = "[wsl2]\r\nkernel = C:\\\\k\\\\bzImage\r\nmemory = 4GB\r\n"
+	for name, b := range map[string][]byte{
+		"utf-8 bom":    append([]byte("\xef\xbb\xbf"), config...),
+		"utf-16le bom": utf16LE(config, true),
+	} {
+		t.Run(name, func(t *testing.T) {
+			dir := tempDir(t)
+			setString(t, windowsHome, dir)
+			setBool(t, assumeYes, true)
+			fn := path.Join(dir, wslConfigFile)
+			if err := ioutil.WriteFile(fn, b, 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			kernel, err := wslConfigGetKernelPath()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := "/mnt/c/k/bzImage"; kernel != want {
+				t.Errorf("wslConfigGetKernelPath() = %q, want %q", kernel, want)
+			}
+
+			if err = wslConfigSetKernel("/mnt/c/k/bzImage.new"); err != nil {
+				t.Fatal(err)
+			}
+			saved, err := ioutil.ReadFile(fn)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := "[wsl2]\nkernel = C:\\\\k\\\\bzImage.new\nmemory = 4GB\n\n" // ini ends sections with a blank line
+			if !bytes.Equal(saved, []byte(want)) {
+				t.Errorf("saved configuration = %q, want %q in UTF-8 without BOM", saved, want)
+			}
+		})
+	}
+}
+
+func TestWSLConfigSaveFormat(t *testing.T) {
+	setBool(t, quiet, true)
+	cfg, err := ini.Load([]byte("; WSL settings\n[wsl2]\nkernel=C:\\\\k\\\\bzImage\n" +
+		"kernelCommandLine = vsyscall=emulate\n# no swap\nswap     = 0\nnote = `a; b`\n[experimental]\nautoMemoryReclaim = gradual\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fn := path.Join(tempDir(t), wslConfigFile)
+
+	if err = wslConfigSave(cfg, fn); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "; WSL settings\n[wsl2]\nkernel = C:\\\\k\\\\bzImage\nkernelCommandLine = vsyscall=emulate\n# no swap\nswap = 0\nnote = `a; b`\n\n" +
+		"[experimental]\nautoMemoryReclaim = gradual\n\n"
+	if string(b) != want {
+		t.Errorf("saved configuration = %q, want %q", b, want)
+	}
+
+	// the saved configuration reads back the same
+	saved, err := ini.Load(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, section := range cfg.Sections() {
+		for _, key := range section.Keys() {
+			if got := saved.Section(section.Name()).Key(key.Name()).String(); got != key.String() {
+				t.Errorf("saved [%s] %s = %q, want %q", section.Name(), key.Name(), got, key.String())
+			}
+		}
+	}
+}
+
+func TestWSLConfigSetKernelSymlink(t *testing.T) {
+	setBool(t, quiet, true)
+	setBool(t, assumeYes, true)
+	dir := tempDir(t)
+	setString(t, windowsHome, dir)
+	// e.g., a .wslconfig kept in a dotfiles repository
+	target := path.Join(dir, "dotfiles.wslconfig")
+	if err := ioutil.WriteFile(target, []byte("[wsl2]\nmemory = 4GB\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	link := path.Join(dir, wslConfigFile)
+	if err := os.Symlink(target, link); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := wslConfigSetKernel("/mnt/c/k/bzImage"); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := os.Lstat(link); err != nil || fi.Mode()&os.ModeSymlink == 0 {
+		t.Fatalf("%s is no longer a symlink: %v", link, err)
+	}
+	b, err := ioutil.ReadFile(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), "kernel = C:\\\\k\\\\bzImage") || !strings.Contains(string(b), "memory = 4GB") {
+		t.Errorf("symlink target not updated: %q", b)
+	}
+}
+
+func TestUserHomeDirectoryFallback(t *testing.T) {
+	errLookup := errors.New("user: Current requires cgo")
+	tests := []struct {
+		name          string
+		user          *user.User
+		home, profile string
+		want          string
+		wantErr       bool
+	}{
+		{name: "current user", user: &user.User{HomeDir: "/home/me"}, home: "/home/env", want: "/home/me"},
+		{name: "HOME", home: "/home/env", profile: `C:\Users\me`, want: "/home/env"},
+		{name: "USERPROFILE", profile: `C:\Users\me`, want: `C:\Users\me`},
+		{name: "none", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			old := currentUser
+			currentUser = func() (*user.User, error) {
+				if tt.user == nil {
+					return nil, errLookup
+				}
+				return tt.user, nil
+			}
+			t.Cleanup(func() { currentUser = old })
+			setEnv(t, "HOME", tt.home)
+			setEnv(t, "USERPROFILE", tt.profile)
+
+			got, err := userHomeDirectory()
+			if tt.wantErr {
+				if !errors.Is(err, errNoHomeDirectory) {
+					t.Errorf("userHomeDirectory() error = %v, want errNoHomeDirectory", err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("userHomeDirectory() = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestKernelDir(t *testing.T) {
+	tests := []struct {
+		kernel, want string
+	}{
+		{`C:\\a\\b`, `C:\\a`},
+		{`C:\a\b`, `C:\a`},
+		{`C:\bzImage`, `C:\`},
+		{`C:\\bzImage`, `C:\`},
+		{"/mnt/c/x/y", "/mnt/c/x"},
+		{"/bzImage", "/"},
+		{"bzImage", "."},
+	}
+	for _, tt := range tests {
+		if got := kernelDir(tt.kernel); got != tt.want {
+			t.Errorf("kernelDir(%q) = %q, want %q", tt.kernel, got, tt.want)
+		}
+	}
+}
+
+func TestWSLConfigSetKernelWindowsHost(t *testing.T) {
+	setBool(t, assumeYes, true)
+	dir := tempDir(t)
+	old, oldUser := windowsHost, currentUser
+	windowsHost = true
+	currentUser = func() (*user.User, error) { return &user.User{HomeDir: dir}, nil }
+	t.Cleanup(func() { windowsHost, currentUser = old, oldUser })
+
+	// e.g., as made absolute with filepath.Abs on Windows
+	if err := wslConfigSetKernel(`C:\Users\me\bzImage`); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(path.Join(dir, wslConfigFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `kernel = C:\\Users\\me\\bzImage`; !strings.Contains(string(b), want) {
+		t.Errorf("saved configuration = %q, want %q", b, want)
+	}
+}